@@ -0,0 +1,22 @@
+package apiclient
+
+import (
+	"github.com/mja00/kami-chan-server-installer/httpcache"
+	"net/http"
+	"time"
+)
+
+// Every API client gets its http.Client from here, so they all share the one timeout from --timeout
+
+// Timeout is how long a single API request can take
+var Timeout = 30 * time.Second
+
+// New returns a client for API requests that gives up after Timeout
+func New() *http.Client {
+	return &http.Client{Timeout: Timeout}
+}
+
+// NewCached is New, but the responses go through the API response cache, httpcache.Default
+func NewCached() *http.Client {
+	return &http.Client{Timeout: Timeout, Transport: httpcache.Default}
+}
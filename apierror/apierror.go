@@ -0,0 +1,140 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goccy/go-json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the errors every API client returns, whichever software it's for, so callers can tell a typo'd version
+// from the API being down
+
+// ResponseError is any response we didn't expect that doesn't have a more specific error
+type ResponseError struct {
+	// Who we were asking, e.g. the Paper API
+	API        string
+	URL        string
+	StatusCode int
+	Status     string
+	// The error the API gave us, if it gave one
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s returned %s for %s: %s", e.API, e.Status, e.URL, e.Message)
+	}
+	return fmt.Sprintf("%s returned %s for %s", e.API, e.Status, e.URL)
+}
+
+// VersionNotFoundError is returned when the project doesn't have the version
+type VersionNotFoundError struct {
+	Project string
+	Version string
+	// The response that told us, nil if we worked it out some other way
+	Err *ResponseError
+}
+
+func (e *VersionNotFoundError) Error() string {
+	return fmt.Sprintf("%s doesn't have a version %s", e.Project, e.Version)
+}
+
+func (e *VersionNotFoundError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// NoBuildsError is returned when the version exists but there's nothing we're allowed to install
+type NoBuildsError struct {
+	Project string
+	Version string
+	// The channel policy that ruled out the builds there are, empty when there aren't any builds at all
+	Channel string
+}
+
+func (e *NoBuildsError) Error() string {
+	switch e.Channel {
+	case "":
+		return fmt.Sprintf("%s %s doesn't have any builds yet", e.Project, e.Version)
+	case "promoted":
+		return fmt.Sprintf("%s %s doesn't have any promoted builds, use the default channel to get the newest stable build", e.Project, e.Version)
+	}
+	return fmt.Sprintf("%s %s only has experimental builds, allow experimental builds to use them", e.Project, e.Version)
+}
+
+// RateLimitedError is returned when the API says we've made too many requests
+type RateLimitedError struct {
+	API string
+	URL string
+	// How long the API wants us to wait, 0 if it didn't say
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s is rate limiting us, try again in %s", e.API, e.RetryAfter)
+	}
+	return e.API + " is rate limiting us, try again in a bit"
+}
+
+// ServerError is returned when the API itself is having problems
+type ServerError struct {
+	API        string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s is having problems (%s), try again later", e.API, e.Status)
+}
+
+// CheckResponse turns a response that isn't a 200 into one of the errors above. api is who we were asking, e.g. the
+// Paper API, for the error message
+func CheckResponse(resp *http.Response, api string) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	url := resp.Request.URL.String()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return &RateLimitedError{API: api, URL: url, RetryAfter: retryAfter}
+	case resp.StatusCode >= 500:
+		return &ServerError{API: api, URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	apiErr := &ResponseError{API: api, URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	// Paper's APIs send {"error": "Version not found."}, v3 can add a message too. Anything else just gets the status
+	var body struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body) == nil {
+		apiErr.Message = strings.TrimSpace(strings.TrimSpace(body.Error) + " " + body.Message)
+	}
+	return apiErr
+}
+
+// VersionError turns a 404 about the version into a VersionNotFoundError, anything else is returned as is
+func VersionError(err error, projectID, version string) error {
+	var apiErr *ResponseError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+	// A missing project is also a 404, so only blame the version when that's what the API said
+	message := strings.ToLower(apiErr.Message)
+	if message != "" && !strings.Contains(message, "version") {
+		return err
+	}
+	return &VersionNotFoundError{Project: projectID, Version: version, Err: apiErr}
+}
@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This keeps copies of previously installed server jars around so we can roll back to them
+
+// Dir is the name of the folder inside the server folder that holds the old jars
+const Dir = "versions"
+
+// Keep is how many old jars we hold on to before the oldest ones get deleted
+const Keep = 5
+
+type Jar struct {
+	Software string
+	Version  string
+	Build    string
+	Path     string
+	// The checksum recorded when the jar was installed, like sha256:abc, empty if we don't have one
+	Checksum string
+	ModTime  time.Time
+}
+
+// checksumSuffix is added to an archived jar's name for the file holding its checksum
+const checksumSuffix = ".checksum"
+
+func jarName(software, version, build string) string {
+	return fmt.Sprintf("%s_%s_%s.jar", software, version, build)
+}
+
+// parseJarName splits an archived jar name back up. The parts are joined with underscores, as builds can have dashes
+// in them (NeoForge betas) and versions can too (pre-releases)
+func parseJarName(name string) (software, version, build string, ok bool) {
+	split := strings.Split(strings.TrimSuffix(name, ".jar"), "_")
+	if len(split) != 3 {
+		return "", "", "", false
+	}
+	return split[0], split[1], split[2], true
+}
+
+// Store copies the jar into the versions folder of the server and prunes old jars. The checksum is kept next to it, as
+// not all software publishes one we could check the jar against later
+func Store(serverDir, jarPath, software, version, build, checksum string) error {
+	if _, err := os.Stat(jarPath); os.IsNotExist(err) {
+		// Nothing installed yet, so nothing to keep
+		return nil
+	}
+	dir := filepath.Join(serverDir, Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	archived := filepath.Join(dir, jarName(software, version, build))
+	if err := utils.CopyFile(jarPath, archived); err != nil {
+		return err
+	}
+	_ = os.Remove(archived + checksumSuffix)
+	if checksum != "" {
+		if err := os.WriteFile(archived+checksumSuffix, []byte(checksum+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	return Prune(serverDir, Keep)
+}
+
+// List returns all the archived jars, newest first
+func List(serverDir string) ([]Jar, error) {
+	entries, err := os.ReadDir(filepath.Join(serverDir, Dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var jars []Jar
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jar") {
+			continue
+		}
+		// Names look like paper_1.21.1_130.jar
+		software, version, build, ok := parseJarName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(serverDir, Dir, entry.Name())
+		checksum, _ := os.ReadFile(path + checksumSuffix)
+		jars = append(jars, Jar{
+			Software: software,
+			Version:  version,
+			Build:    build,
+			Path:     path,
+			Checksum: strings.TrimSpace(string(checksum)),
+			ModTime:  info.ModTime(),
+		})
+	}
+	sort.Slice(jars, func(i, j int) bool {
+		return jars[i].ModTime.After(jars[j].ModTime)
+	})
+	return jars, nil
+}
+
+// Find looks for an archived jar of the given build. If version is empty, any version will match
+func Find(serverDir, software, version, build string) (*Jar, error) {
+	jars, err := List(serverDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, jar := range jars {
+		if jar.Software == software && jar.Build == build && (version == "" || jar.Version == version) {
+			return &jar, nil
+		}
+	}
+	return nil, fmt.Errorf("no archived %s jar found for build %s", software, build)
+}
+
+// Prune deletes the oldest archived jars until only keep are left
+func Prune(serverDir string, keep int) error {
+	jars, err := List(serverDir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(jars); i++ {
+		if err := os.Remove(jars[i].Path); err != nil {
+			return err
+		}
+		_ = os.Remove(jars[i].Path + checksumSuffix)
+	}
+	return nil
+}
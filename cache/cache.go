@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/download"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This is a cache of downloaded files shared between every server on the machine. Files are stored by their sha256 hash
+// under <dir>/sha256/<hash>/<file name>, so the same jar or JDK is only ever downloaded once
+
+var (
+	// Dir is where the cache lives, an empty Dir means the default under the user's cache directory
+	Dir = ""
+	// Disabled turns the cache off completely
+	Disabled = false
+)
+
+type Entry struct {
+	Hash string
+	Name string
+	Path string
+	Size int64
+	// When the entry was last used, we bump this on every hit so prune keeps what's actually used
+	LastUsed time.Time
+}
+
+func GetDir() (string, error) {
+	if Dir != "" {
+		return Dir, nil
+	}
+	// This is $XDG_CACHE_HOME or ~/.cache on Linux
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userCache, "kami-chan-server-installer"), nil
+}
+
+func entryDir(hash string) (string, error) {
+	dir, err := GetDir()
+	if err != nil {
+		return "", err
+	}
+	// The hash ends up in a path, so make sure it really is one
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+		return "", fmt.Errorf("invalid sha256 hash: %s", hash)
+	}
+	return filepath.Join(dir, "sha256", strings.ToLower(hash)), nil
+}
+
+// Get puts the cached file with the given sha256 hash at dest. It returns false if we don't have it
+func Get(hash, dest string) (bool, error) {
+	if Disabled || hash == "" {
+		return false, nil
+	}
+	dir, err := entryDir(hash)
+	if err != nil {
+		return false, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		return false, nil
+	}
+	cached := filepath.Join(dir, entries[0].Name())
+	// It's hashed as it's copied, so we know nothing has touched the file since we stored it. A copy rather than a
+	// link, otherwise editing the jar in the server folder would edit the cache too
+	fileHash, err := copyFile(cached, dest, hash)
+	if err != nil {
+		return false, err
+	}
+	if !strings.EqualFold(fileHash, hash) {
+		log.Printf("Cached %s is corrupt, removing it\n", entries[0].Name())
+		_ = os.RemoveAll(dir)
+		return false, nil
+	}
+	now := time.Now()
+	_ = os.Chtimes(cached, now, now)
+	return true, nil
+}
+
+// Put adds the file at path to the cache. The hash is checked so a bad file can't end up in the cache
+func Put(path, hash string) error {
+	if Disabled {
+		return nil
+	}
+	if hash == "" {
+		var err error
+		hash, err = hashFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	dir, err := entryDir(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Copied rather than linked, so the cached file can't change when the one in the server folder does
+	fileHash, err := copyFile(path, filepath.Join(dir, filepath.Base(path)), hash)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(fileHash, hash) {
+		_ = os.Remove(dir)
+		return fmt.Errorf("sha256 hash of %s does not match, expected %s but got %s", path, hash, fileHash)
+	}
+	return nil
+}
+
+// Download is download.Downloader.Download, but it checks the cache first and adds the file to it afterwards.
+// Only sha256 checksums can be looked up, anything else is just downloaded
+func Download(ctx context.Context, downloader *download.Downloader, req download.Request) error {
+	if req.Algorithm != "sha256" || req.Checksum == "" {
+		return downloader.Download(ctx, req)
+	}
+	found, err := Get(req.Checksum, req.Dest)
+	if err != nil {
+		log.Printf("Couldn't check the cache for %s: %s\n", filepath.Base(req.Dest), err)
+	}
+	if found {
+		log.Printf("Using cached %s\n", filepath.Base(req.Dest))
+		return nil
+	}
+	if err := downloader.Download(ctx, req); err != nil {
+		return err
+	}
+	// Not being able to cache the file isn't a reason to fail the download
+	if err := Put(req.Dest, req.Checksum); err != nil {
+		log.Printf("Couldn't add %s to the cache: %s\n", filepath.Base(req.Dest), err)
+	}
+	return nil
+}
+
+// List returns everything in the cache, most recently used first
+func List() ([]Entry, error) {
+	dir, err := GetDir()
+	if err != nil {
+		return nil, err
+	}
+	hashDirs, err := os.ReadDir(filepath.Join(dir, "sha256"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, hashDir := range hashDirs {
+		if !hashDir.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, "sha256", hashDir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			info, err := file.Info()
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, Entry{
+				Hash:     hashDir.Name(),
+				Name:     file.Name(),
+				Path:     filepath.Join(dir, "sha256", hashDir.Name(), file.Name()),
+				Size:     info.Size(),
+				LastUsed: info.ModTime(),
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// Prune removes every entry that hasn't been used since before the given time and returns what it removed
+func Prune(before time.Time) ([]Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []Entry
+	for _, entry := range entries {
+		if !entry.LastUsed.Before(before) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Dir(entry.Path)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+// Clear removes everything in the cache and returns what it removed
+func Clear() ([]Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := GetDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "sha256")); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// copyFile copies src to dest and returns the sha256 hash of what was copied. If hash isn't empty, dest is only
+// replaced when the copy matches it
+func copyFile(src, dest, hash string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hasher, err := download.NewHash("sha256")
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), in); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	fileHash := hex.EncodeToString(hasher.Sum(nil))
+	if hash != "" && !strings.EqualFold(fileHash, hash) {
+		return fileHash, nil
+	}
+	return fileHash, os.Rename(tmp.Name(), dest)
+}
+
+func hashFile(path string) (string, error) {
+	hash, err := download.NewHash("sha256")
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
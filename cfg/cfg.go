@@ -8,16 +8,49 @@ import (
 // This'll handle our config file that'll store information about the server for our use
 
 type Config struct {
+	// The server software that's installed, e.g. paper or folia
+	Software         string `json:"software"`
 	MinecraftVersion string `json:"minecraft_version"`
-	PaperBuild       string `json:"paper_build"`
-	LastPaperBuild   string `json:"last_paper_build"`
+	// The build of the installed software. It's called PaperBuild as Paper used to be all we supported
+	PaperBuild string `json:"paper_build"`
+	// The mod loader version, only set when the software is a mod loader like Fabric
+	LoaderVersion string `json:"loader_version"`
+	// The checksum of the installed build, e.g. sha256:abc or md5:abc
+	BuildChecksum  string `json:"build_checksum"`
+	LastPaperBuild string `json:"last_paper_build"`
+	// The Minecraft version LastPaperBuild belongs to
+	LastMinecraftVersion string `json:"last_minecraft_version"`
+	// Which builds setup and update are allowed to pick: promoted, default or experimental
+	Channel string `json:"channel"`
+	// When set, update leaves the server on this build
+	PinnedBuild string `json:"pinned_build"`
+	// The java the server runs with, relative to the server folder for a portable JDK inside it. Empty means the one on the PATH
+	JavaPath string `json:"java_path"`
+	// The modpack the server was set up from, if any
+	Modpack *Modpack `json:"modpack,omitempty"`
+}
+
+type Modpack struct {
+	// Where the pack came from, e.g. modrinth
+	Source  string `json:"source"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Every file the pack put in the server folder, so upgrading can clean up files the new version dropped
+	Files []string `json:"files"`
 }
 
 func NewConfig() *Config {
 	return &Config{
-		MinecraftVersion: "",
-		PaperBuild:       "",
-		LastPaperBuild:   "",
+		Software:             "",
+		MinecraftVersion:     "",
+		PaperBuild:           "",
+		LoaderVersion:        "",
+		BuildChecksum:        "",
+		LastPaperBuild:       "",
+		LastMinecraftVersion: "",
+		Channel:              "",
+		PinnedBuild:          "",
+		JavaPath:             "",
 	}
 }
 
@@ -32,8 +65,8 @@ func (c *Config) Save(path string) error {
 		}
 		defer file.Close()
 	} else {
-		// Open the file
-		file, err = os.OpenFile(path, os.O_RDWR, 0644)
+		// Open the file, truncating it so a shorter config doesn't leave old bytes behind
+		file, err = os.OpenFile(path, os.O_RDWR|os.O_TRUNC, 0644)
 		if err != nil {
 			return err
 		}
@@ -80,6 +113,22 @@ func (c *Config) SetPaperBuild(build string) {
 	c.PaperBuild = build
 }
 
+func (c *Config) GetLoaderVersion() string {
+	return c.LoaderVersion
+}
+
+func (c *Config) SetLoaderVersion(version string) {
+	c.LoaderVersion = version
+}
+
+func (c *Config) GetBuildChecksum() string {
+	return c.BuildChecksum
+}
+
+func (c *Config) SetBuildChecksum(checksum string) {
+	c.BuildChecksum = checksum
+}
+
 func (c *Config) GetLastPaperBuild() string {
 	return c.LastPaperBuild
 }
@@ -95,3 +144,59 @@ func (c *Config) SetMinecraftVersion(version string) {
 func (c *Config) GetMinecraftVersion() string {
 	return c.MinecraftVersion
 }
+
+func (c *Config) GetLastMinecraftVersion() string {
+	return c.LastMinecraftVersion
+}
+
+func (c *Config) SetLastMinecraftVersion(version string) {
+	c.LastMinecraftVersion = version
+}
+
+// GetSoftware returns the installed server software. Configs from before we supported other software are always Paper
+func (c *Config) GetSoftware() string {
+	if c.Software == "" {
+		return "paper"
+	}
+	return c.Software
+}
+
+func (c *Config) SetSoftware(software string) {
+	c.Software = software
+}
+
+// GetChannel returns the channel policy. Configs from before we had one always used the default channel
+func (c *Config) GetChannel() string {
+	if c.Channel == "" {
+		return "default"
+	}
+	return c.Channel
+}
+
+func (c *Config) SetChannel(channel string) {
+	c.Channel = channel
+}
+
+func (c *Config) GetPinnedBuild() string {
+	return c.PinnedBuild
+}
+
+func (c *Config) SetPinnedBuild(build string) {
+	c.PinnedBuild = build
+}
+
+func (c *Config) GetJavaPath() string {
+	return c.JavaPath
+}
+
+func (c *Config) SetJavaPath(javaPath string) {
+	c.JavaPath = javaPath
+}
+
+func (c *Config) GetModpack() *Modpack {
+	return c.Modpack
+}
+
+func (c *Config) SetModpack(modpack *Modpack) {
+	c.Modpack = modpack
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/cache"
+	"github.com/mja00/kami-chan-server-installer/httpcache"
+	"github.com/urfave/cli/v2"
+	"log"
+	"time"
+)
+
+var cacheCmd = &cli.Command{
+	Name:        "cache",
+	Description: "Manage the download cache shared between servers",
+	Usage:       "Manage the download cache shared between servers",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "List the cached downloads",
+			Action: func(c *cli.Context) error {
+				dir, err := cache.GetDir()
+				if err != nil {
+					return err
+				}
+				entries, err := cache.List()
+				if err != nil {
+					return err
+				}
+				if len(entries) == 0 {
+					log.Printf("The cache at %s is empty\n", dir)
+					return nil
+				}
+				var total int64
+				for _, entry := range entries {
+					fmt.Printf("%s  %-40s %10s  last used %s\n", entry.Hash[:12], entry.Name, formatSize(entry.Size), entry.LastUsed.Format("2006-01-02 15:04"))
+					total += entry.Size
+				}
+				fmt.Printf("%d files, %s in %s\n", len(entries), formatSize(total), dir)
+				return nil
+			},
+		},
+		{
+			Name:  "prune",
+			Usage: "Remove cached downloads that haven't been used in a while",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{Name: "older-than", Usage: "Remove files that haven't been used for this long", Value: 30 * 24 * time.Hour},
+				&cli.BoolFlag{Name: "all", Usage: "Remove everything in the cache"},
+			},
+			Action: func(c *cli.Context) error {
+				var removed []cache.Entry
+				var err error
+				if c.Bool("all") {
+					// The cached API responses go too, they're quick to get back
+					if err := httpcache.Clear(); err != nil {
+						return err
+					}
+					removed, err = cache.Clear()
+				} else {
+					removed, err = cache.Prune(time.Now().Add(-c.Duration("older-than")))
+				}
+				if err != nil {
+					return err
+				}
+				var total int64
+				for _, entry := range removed {
+					log.Printf("Removed %s\n", entry.Name)
+					total += entry.Size
+				}
+				log.Printf("Removed %d files, freeing %s\n", len(removed), formatSize(total))
+				return nil
+			},
+		},
+	},
+}
+
+func init() {
+	rootCmd.Commands = append(rootCmd.Commands, cacheCmd)
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
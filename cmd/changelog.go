@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"github.com/urfave/cli/v2"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+var changelogCmd = &cli.Command{
+	Name:        "changelog",
+	Description: "Show what changed between the installed build and another build",
+	Usage:       "Show what changed between the installed build and another build",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "to", Usage: "Build to show the changes up to. Defaults to the build update would install"},
+		&cli.StringFlag{Name: "from", Usage: "Build to show the changes since. Defaults to the installed build"},
+		&cli.StringFlag{Name: "minecraft-version", Usage: "Minecraft version the builds are for. Defaults to the installed version"},
+		&cli.StringFlag{Name: "format", Usage: "Output format (text, json)", Value: "text"},
+	},
+	Before: func(c *cli.Context) error {
+		config := cfg.NewConfig()
+		_ = config.Load(utils.GetServerFolder(".kami.json", c))
+		c.Context = context.WithValue(c.Context, "config", config)
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		config := c.Context.Value("config").(*cfg.Config)
+		format := c.String("format")
+		if format != "text" && format != "json" {
+			return fmt.Errorf("unknown format %s, it has to be text or json", format)
+		}
+		serverSoftware, err := provider.Get(config.GetSoftware())
+		if err != nil {
+			return err
+		}
+		version := config.GetMinecraftVersion()
+		if c.IsSet("minecraft-version") {
+			version = c.String("minecraft-version")
+		}
+		if version == "" {
+			return fmt.Errorf("no Minecraft version is installed, use --minecraft-version to pick one")
+		}
+		from := config.GetPaperBuild()
+		if c.IsSet("from") {
+			from = c.String("from")
+		}
+		to := c.String("to")
+		if to == "" {
+			policy, err := provider.ChannelPolicyFor(serverSoftware, config.GetChannel())
+			if err != nil {
+				return err
+			}
+			build, err := provider.LatestBuild(c.Context, serverSoftware, version, policy)
+			if err != nil {
+				return explainVersionError(c.Context, serverSoftware, version, err)
+			}
+			to = build.ID
+		}
+		builds, err := provider.Changelog(c.Context, serverSoftware, version, from, to)
+		if err != nil {
+			return explainVersionError(c.Context, serverSoftware, version, err)
+		}
+		if format == "json" {
+			return writeChangelogJSON(os.Stdout, serverSoftware.Name(), version, from, to, builds)
+		}
+		if len(builds) == 0 {
+			log.Printf("Nothing has changed between build %s and build %s\n", from, to)
+			return nil
+		}
+		writeChangelog(os.Stdout, builds)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.Commands = append(rootCmd.Commands, changelogCmd)
+}
+
+// writeChangelog prints each build followed by its changes
+func writeChangelog(w io.Writer, builds []provider.Build) {
+	for _, build := range builds {
+		fmt.Fprintf(w, "Build %s", build.ID)
+		if !build.Time.IsZero() {
+			fmt.Fprintf(w, " (%s)", build.Time.Format("2006-01-02"))
+		}
+		if !build.Stable {
+			fmt.Fprint(w, " [experimental]")
+		}
+		fmt.Fprintln(w)
+		if len(build.Changes) == 0 {
+			fmt.Fprintln(w, "  - No changes listed")
+		}
+		for _, change := range build.Changes {
+			commit := change.Commit
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			fmt.Fprintf(w, "  - %s %s\n", commit, change.Summary)
+		}
+	}
+}
+
+type changelogOutput struct {
+	Software         string           `json:"software"`
+	MinecraftVersion string           `json:"minecraft_version"`
+	From             string           `json:"from"`
+	To               string           `json:"to"`
+	Builds           []changelogBuild `json:"builds"`
+}
+
+type changelogBuild struct {
+	Build   string            `json:"build"`
+	Time    time.Time         `json:"time"`
+	Channel string            `json:"channel"`
+	Changes []changelogChange `json:"changes"`
+}
+
+type changelogChange struct {
+	Commit  string `json:"commit"`
+	Summary string `json:"summary"`
+	Message string `json:"message"`
+}
+
+func writeChangelogJSON(w io.Writer, software, version, from, to string, builds []provider.Build) error {
+	output := changelogOutput{
+		Software:         software,
+		MinecraftVersion: version,
+		From:             from,
+		To:               to,
+		Builds:           make([]changelogBuild, 0, len(builds)),
+	}
+	for _, build := range builds {
+		output.Builds = append(output.Builds, changelogBuild{Build: build.ID, Time: build.Time, Channel: build.Channel, Changes: changelogChanges(build.Changes)})
+	}
+	return writeJSON(w, output)
+}
+
+func changelogChanges(changes []provider.Change) []changelogChange {
+	result := make([]changelogChange, 0, len(changes))
+	for _, change := range changes {
+		result = append(result, changelogChange{Commit: change.Commit, Summary: change.Summary, Message: change.Message})
+	}
+	return result
+}
@@ -0,0 +1,523 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"github.com/mja00/kami-chan-server-installer/archive"
+	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/lock"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"github.com/pbnjay/memory"
+	"github.com/urfave/cli/v2"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// These are shared between setup, update and rollback, as they all end up installing a build
+
+// getRAMAmount returns how much RAM in MB the server should be started with
+func getRAMAmount() int {
+	// Get the RAM of the machine
+	totalRAM := float64(memory.TotalMemory())
+	// At most we'll only ever set the script to use 10GB of RAM
+	// Otherwise we'll use 75% of the total RAM
+	ramAmount := int(math.Min(float64(10*1024*1024*1024), totalRAM*0.75))
+	// Conver the amount to MB
+	return ramAmount / 1024 / 1024
+}
+
+// installBuild downloads the build into the server folder. If the software ships an installer, it gets run too
+func installBuild(c *cli.Context, serverSoftware provider.Provider, version, build string) (*provider.Download, error) {
+	jarPath := utils.GetServerFolder(provider.JarName(serverSoftware), c)
+	var installed *provider.Checksum
+	if config, ok := c.Context.Value("config").(*cfg.Config); ok && config.GetSoftware() == serverSoftware.Name() && config.GetMinecraftVersion() == version && config.GetPaperBuild() == build {
+		installed = provider.ParseChecksum(config.GetBuildChecksum())
+	}
+	download, err := provider.Install(c.Context, serverSoftware, version, build, jarPath, installed)
+	if err != nil {
+		return nil, err
+	}
+	return download, runInstaller(c, serverSoftware)
+}
+
+// runInstaller runs the installer for software that ships one, then hands our JVM arguments to its run script
+func runInstaller(c *cli.Context, serverSoftware provider.Provider) error {
+	installer, ok := serverSoftware.(provider.Installer)
+	if !ok {
+		return nil
+	}
+	log.Printf("Running the %s installer...\n", serverSoftware.Name())
+	err := installer.RunInstaller(c.Context, serverJava(c), utils.GetServerFolder(provider.JarName(serverSoftware), c), utils.GetServerFolder("", c))
+	if err != nil {
+		return err
+	}
+	if javaPath := configuredJava(c); javaPath != "" {
+		err = pointRunScriptAtJava(utils.GetStartScript(utils.GetServerFolder("run", c)), javaPath)
+		if err != nil {
+			return err
+		}
+	}
+	return utils.WriteJVMArgsFile(utils.GetServerFolder("user_jvm_args.txt", c), getRAMAmount())
+}
+
+// pointRunScriptAtJava makes an installer's run script use our java rather than the one on the PATH
+func pointRunScriptAtJava(scriptPath, javaPath string) error {
+	script, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(script), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "java ") {
+			lines[i] = utils.ScriptJava(javaPath) + strings.TrimPrefix(line, "java")
+		}
+	}
+	return os.WriteFile(scriptPath, []byte(strings.Join(lines, "\n")), 0755)
+}
+
+// writeStartScript writes our start script and returns where it is.
+// Software with an installer brings its own run script, so that's used instead
+func writeStartScript(c *cli.Context, serverSoftware provider.Provider) (string, error) {
+	if _, ok := serverSoftware.(provider.Installer); ok {
+		return utils.GetStartScript(utils.GetServerFolder("run", c)), nil
+	}
+	err := utils.WriteStartScript(utils.GetServerFolder("start", c), configuredJava(c), provider.JarName(serverSoftware), getRAMAmount(), c)
+	if err != nil {
+		return "", err
+	}
+	return utils.GetStartScript(utils.GetServerFolder("start", c)), nil
+}
+
+// configuredJava is the java recorded in .kami.json, empty if the server uses the one on the PATH
+func configuredJava(c *cli.Context) string {
+	config, ok := c.Context.Value("config").(*cfg.Config)
+	if !ok {
+		return ""
+	}
+	return config.GetJavaPath()
+}
+
+// serverJava is the java to run things for the server with, as something we can run from anywhere
+func serverJava(c *cli.Context) string {
+	javaPath := configuredJava(c)
+	if javaPath == "" {
+		return "java"
+	}
+	if !filepath.IsAbs(javaPath) {
+		javaPath = utils.GetServerFolder(javaPath, c)
+	}
+	if absolute, err := filepath.Abs(javaPath); err == nil {
+		return absolute
+	}
+	return javaPath
+}
+
+// ensureJava makes sure Java is at least the required version, installing it if it isn't. If a JDK gets downloaded,
+// or the server uses a portable JDK we downloaded before, it's returned so it can go in the lockfile. When frozen is
+// set, the JDK has to be the one in it
+func ensureJava(c *cli.Context, requiredJavaVersion int, frozen *lock.Lockfile) (*lock.Artifact, error) {
+	config := c.Context.Value("config").(*cfg.Config)
+	log.Println("Checking for Java...")
+	// A frozen install gets exactly the JDK in the lockfile, whatever Java is already around
+	if frozen != nil && frozen.Get(lock.JDK) != nil {
+		return installLockedJava(c, config, requiredJavaVersion, *frozen.Get(lock.JDK))
+	}
+	// Whichever Java was picked for this server last time wins
+	if config.GetJavaPath() != "" {
+		javaVersion, err := utils.GetJavaVersionAt(serverJava(c))
+		if err == nil && javaVersion.Major >= requiredJavaVersion {
+			log.Printf("Java version: %s (%s)\n", javaVersion.Version, config.GetJavaPath())
+			return portableJavaArtifact(c, serverJava(c)), nil
+		}
+	}
+	// Otherwise anything already on the machine that's new enough will do
+	if best := utils.BestJava(utils.DiscoverJava(javaDirs(c)...), requiredJavaVersion); best != nil {
+		log.Printf("Java version: %s (%s)\n", best.Version.Version, describeJava(*best))
+		// The java on the PATH stays as plain java, so the server follows along when it's updated
+		if isPathJava(best.Path) {
+			config.SetJavaPath("")
+		} else {
+			config.SetJavaPath(serverRelativePath(c, best.Path))
+		}
+		return portableJavaArtifact(c, best.Path), nil
+	}
+	log.Printf("Couldn't find Java %d or newer\n", requiredJavaVersion)
+	if frozen != nil {
+		return nil, fmt.Errorf("java %d is needed but %s doesn't have a JDK in it", requiredJavaVersion, lock.FileName)
+	}
+	if usePortableJava(c) {
+		return installPortableJava(c, config, requiredJavaVersion)
+	}
+	log.Println("Java version is too low, downloading...")
+	fileLoc, javaURL, err := utils.DownloadJava(requiredJavaVersion, c)
+	if err != nil {
+		return nil, err
+	}
+	var jdk *lock.Artifact
+	// On Linux we might not have downloaded anything, the user gets told how to install it instead
+	if fileLoc != "" {
+		jdk, err = lockJava(javaURL, fileLoc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return jdk, installSystemJava(c, config, requiredJavaVersion, fileLoc)
+}
+
+// installSystemJava runs the Java installer we downloaded and makes sure the java on the PATH is new enough after
+func installSystemJava(c *cli.Context, config *cfg.Config, requiredJavaVersion int, fileLoc string) error {
+	log.Println("Installing Java...")
+	err := utils.InstallJava(fileLoc, c)
+	if err != nil {
+		return err
+	}
+	// Re-verify the Java version
+	javaVersion, err := utils.GetJavaVersion()
+	if err != nil {
+		return err
+	}
+	// If we're still too low then something went wrong, error and let the user figure it out
+	if javaVersion.Major < requiredJavaVersion {
+		return fmt.Errorf("java version must be at least %d", requiredJavaVersion)
+	}
+	config.SetJavaPath("")
+	return nil
+}
+
+// installLockedJava downloads the JDK in the lockfile, failing if it doesn't match, and installs it the way it was
+// installed when the lockfile was made
+func installLockedJava(c *cli.Context, config *cfg.Config, requiredJavaVersion int, locked lock.Artifact) (*lock.Artifact, error) {
+	if locked.URL == "" {
+		return nil, fmt.Errorf("the JDK in %s doesn't say where to download it from", lock.FileName)
+	}
+	if err := os.MkdirAll("temp", 0755); err != nil {
+		return nil, err
+	}
+	fileLoc := filepath.Join("temp", filepath.Base(locked.Path))
+	log.Printf("Downloading the Java in %s...\n", lock.FileName)
+	err := provider.Fetch(c.Context, &provider.Download{URL: locked.URL, FileName: filepath.Base(locked.Path), Checksum: &provider.Checksum{Algorithm: "sha256", Value: locked.SHA256}}, fileLoc)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the JDK in %s: %s", lock.FileName, err)
+	}
+	// Portable JDKs are archives, anything else is an installer
+	if strings.HasSuffix(locked.URL, ".tar.gz") || strings.HasSuffix(locked.URL, ".zip") {
+		err = extractPortableJava(c, config, requiredJavaVersion, fileLoc, locked)
+	} else {
+		err = installSystemJava(c, config, requiredJavaVersion, fileLoc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &locked, nil
+}
+
+// usePortableJava is whether Java gets downloaded just for this server. On Linux that's the default, unless they've
+// asked for the system wide package with --install-java-please
+func usePortableJava(c *cli.Context) bool {
+	if c.IsSet("portable-java") {
+		return c.Bool("portable-java")
+	}
+	return runtime.GOOS == "linux" && !c.Bool("install-java-please")
+}
+
+// installPortableJava extracts a JDK into the java dir and points the server at it
+func installPortableJava(c *cli.Context, config *cfg.Config, requiredJavaVersion int) (*lock.Artifact, error) {
+	dir := filepath.Join(javaDirs(c)[0], utils.PortableJavaName(requiredJavaVersion))
+	// Another server sharing the java dir might have downloaded it already
+	if javaPath := utils.FindPortableJava(dir); javaPath != "" {
+		jdk, err := lock.LoadArtifact(filepath.Join(dir, lock.JDKFileName))
+		if err == nil {
+			log.Printf("Using the Java %d in %s\n", requiredJavaVersion, dir)
+			return jdk, pointAtPortableJava(c, config, requiredJavaVersion, javaPath)
+		}
+		// Without knowing where it came from it can't be locked, so it gets replaced
+		log.Printf("The Java %d in %s doesn't say where it came from, downloading it again\n", requiredJavaVersion, dir)
+	}
+	log.Printf("Downloading Java %d for this server...\n", requiredJavaVersion)
+	archivePath, javaURL, err := utils.DownloadPortableJava(c.Context, requiredJavaVersion)
+	if err != nil {
+		return nil, err
+	}
+	jdk, err := lockJava(javaURL, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return jdk, extractPortableJava(c, config, requiredJavaVersion, archivePath, *jdk)
+}
+
+// extractPortableJava extracts the JDK archive into the java dir and points the server at it. jdk is kept with it, so
+// other servers using it can lock it
+func extractPortableJava(c *cli.Context, config *cfg.Config, requiredJavaVersion int, archivePath string, jdk lock.Artifact) error {
+	dir := filepath.Join(javaDirs(c)[0], utils.PortableJavaName(requiredJavaVersion))
+	log.Printf("Extracting Java to %s...\n", dir)
+	javaPath, err := utils.ExtractPortableJava(archivePath, dir)
+	if err != nil {
+		return err
+	}
+	if err := lock.SaveArtifact(filepath.Join(dir, lock.JDKFileName), jdk); err != nil {
+		return err
+	}
+	// It's in the download cache if we need it again
+	_ = os.Remove(archivePath)
+	return pointAtPortableJava(c, config, requiredJavaVersion, javaPath)
+}
+
+// pointAtPortableJava checks the portable JDK runs and is new enough, then points the server at it
+func pointAtPortableJava(c *cli.Context, config *cfg.Config, requiredJavaVersion int, javaPath string) error {
+	javaVersion, err := utils.GetJavaVersionAt(javaPath)
+	if err != nil {
+		return fmt.Errorf("the Java we installed doesn't run: %s", err)
+	}
+	if javaVersion.Major < requiredJavaVersion {
+		return fmt.Errorf("java version must be at least %d, but %s is %s", requiredJavaVersion, javaPath, javaVersion.Version)
+	}
+	config.SetJavaPath(serverRelativePath(c, javaPath))
+	return nil
+}
+
+// portableJavaArtifact is the lockfile artifact of the portable JDK javaPath is in, or nil if it isn't one we extracted
+func portableJavaArtifact(c *cli.Context, javaPath string) *lock.Artifact {
+	for _, javaDir := range javaDirs(c) {
+		javaDir, err := filepath.Abs(javaDir)
+		if err != nil {
+			continue
+		}
+		relative, err := filepath.Rel(javaDir, javaPath)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+		// Each JDK has its own folder in the java dir
+		name, _, _ := strings.Cut(relative, string(filepath.Separator))
+		if jdk, err := lock.LoadArtifact(filepath.Join(javaDir, name, lock.JDKFileName)); err == nil {
+			return jdk
+		}
+	}
+	return nil
+}
+
+// javaDirs are the folders portable JDKs can be in, the first is where new ones go
+func javaDirs(c *cli.Context) []string {
+	serverRuntimes := utils.GetServerFolder("runtime", c)
+	if c.String("java-dir") == "" {
+		return []string{serverRuntimes}
+	}
+	// They might have been downloaded before --java-dir was set
+	return []string{c.String("java-dir"), serverRuntimes}
+}
+
+// describeJava is the vendor, arch and where we found it, e.g. Amazon.com Inc., x64, from SDKMAN at /path/to/java
+func describeJava(javaRuntime utils.JavaRuntime) string {
+	var details []string
+	if javaRuntime.Vendor != "" {
+		details = append(details, javaRuntime.Vendor)
+	}
+	if javaRuntime.Arch != "" {
+		details = append(details, javaRuntime.Arch)
+	}
+	details = append(details, fmt.Sprintf("from %s at %s", javaRuntime.Source, javaRuntime.Path))
+	return strings.Join(details, ", ")
+}
+
+// isPathJava is whether javaPath is the same java running plain java would, even if we found it through JAVA_HOME
+func isPathJava(javaPath string) bool {
+	pathJava, err := exec.LookPath("java")
+	if err != nil {
+		return false
+	}
+	// PATH can have relative folders in it
+	pathJava, err = filepath.Abs(pathJava)
+	if err != nil {
+		return false
+	}
+	a, errA := filepath.EvalSymlinks(javaPath)
+	b, errB := filepath.EvalSymlinks(pathJava)
+	return errA == nil && errB == nil && a == b
+}
+
+// serverRelativePath makes path relative to the server folder if it's inside it, so the folder can be moved around
+func serverRelativePath(c *cli.Context, path string) string {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	serverDir, err := filepath.Abs(utils.GetServerFolder("", c))
+	if err != nil {
+		return absolute
+	}
+	relative, err := filepath.Rel(serverDir, absolute)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return absolute
+	}
+	return relative
+}
+
+// lockJava describes the JDK we downloaded for the lockfile
+func lockJava(javaURL, fileLoc string) (*lock.Artifact, error) {
+	sha256, err := utils.GetSha256Hash(fileLoc)
+	if err != nil {
+		return nil, err
+	}
+	return &lock.Artifact{Name: lock.JDK, Path: filepath.Base(fileLoc), URL: javaURL, SHA256: sha256}, nil
+}
+
+// archiveInstalled keeps a copy of the currently installed jar so it can be rolled back to
+func archiveInstalled(c *cli.Context, config *cfg.Config) error {
+	installedSoftware, err := provider.Get(config.GetSoftware())
+	if err != nil || config.GetMinecraftVersion() == "" || config.GetPaperBuild() == "" {
+		// Nothing we know how to keep
+		return nil
+	}
+	jarPath := utils.GetServerFolder(provider.JarName(installedSoftware), c)
+	return archive.Store(utils.GetServerFolder("", c), jarPath, installedSoftware.Name(), config.GetMinecraftVersion(), config.GetPaperBuild(), config.GetBuildChecksum())
+}
+
+// recordInstall saves what was just installed into the config, remembering what it replaced so it can be rolled back to
+func recordInstall(config *cfg.Config, serverSoftware provider.Provider, version, build string, download *provider.Download) {
+	previousVersion := config.GetMinecraftVersion()
+	previousBuild := config.GetPaperBuild()
+	if previousBuild != "" && (config.GetSoftware() != serverSoftware.Name() || previousVersion != version || previousBuild != build) {
+		config.SetLastMinecraftVersion(previousVersion)
+		config.SetLastPaperBuild(previousBuild)
+	}
+	config.SetSoftware(serverSoftware.Name())
+	config.SetMinecraftVersion(version)
+	config.SetPaperBuild(build)
+	config.SetLoaderVersion(provider.LoaderVersion(serverSoftware, build))
+	config.SetBuildChecksum(download.Checksum.String())
+}
+
+// lockInstall records the installed build in kami.lock, along with the JDK if we downloaded one
+func lockInstall(c *cli.Context, serverSoftware provider.Provider, version, build string, download *provider.Download, jdk *lock.Artifact) error {
+	lockPath := utils.GetServerFolder(lock.FileName, c)
+	lockfile, err := lock.LoadOrNew(lockPath)
+	if err != nil {
+		return err
+	}
+	// Install has already checked the jar against this, only hash it again if the software publishes something else
+	jarName := provider.JarName(serverSoftware)
+	var sha256 string
+	if download.Checksum != nil && download.Checksum.Algorithm == "sha256" {
+		sha256 = download.Checksum.Value
+	} else {
+		sha256, err = utils.GetSha256Hash(utils.GetServerFolder(jarName, c))
+		if err != nil {
+			return err
+		}
+	}
+	lockfile.Software = serverSoftware.Name()
+	lockfile.MinecraftVersion = version
+	lockfile.Build = build
+	lockfile.Set(lock.Artifact{Name: lock.Server, Path: jarName, URL: download.URL, SHA256: sha256})
+	if jdk != nil {
+		lockfile.Set(*jdk)
+	}
+	return lockfile.Save(lockPath)
+}
+
+// installLocked installs the server jar and every other file in the lockfile, failing if any of them don't match it
+func installLocked(c *cli.Context, serverSoftware provider.Provider, lockfile *lock.Lockfile) (*provider.Download, error) {
+	server := lockfile.Get(lock.Server)
+	if server == nil {
+		return nil, fmt.Errorf("%s doesn't have a server jar in it", lock.FileName)
+	}
+	download := &provider.Download{
+		URL:      server.URL,
+		FileName: server.Path,
+		Checksum: &provider.Checksum{Algorithm: "sha256", Value: server.SHA256},
+	}
+	err := provider.Fetch(c.Context, download, utils.GetServerFolder(provider.JarName(serverSoftware), c))
+	if err != nil {
+		return nil, err
+	}
+	err = runInstaller(c, serverSoftware)
+	if err != nil {
+		return nil, err
+	}
+	serverDir := utils.GetServerFolder("", c)
+	for _, artifact := range lockfile.Artifacts {
+		if artifact.Name == lock.Server || artifact.Name == lock.JDK {
+			continue
+		}
+		target, err := utils.SafeJoin(serverDir, artifact.Path)
+		if err != nil {
+			return nil, err
+		}
+		checksum := &provider.Checksum{Algorithm: "sha256", Value: artifact.SHA256}
+		// Files that came out of a modpack's zip can't be downloaded again, they have to already be there
+		if artifact.URL == "" {
+			if _, err := os.Stat(target); err != nil {
+				return nil, fmt.Errorf("%s is in %s but isn't in the server folder", artifact.Path, lock.FileName)
+			}
+			if err := provider.VerifyFile(target, checksum); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		err = provider.Fetch(c.Context, &provider.Download{URL: artifact.URL, FileName: filepath.Base(artifact.Path), Checksum: checksum}, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return download, nil
+}
+
+// explainVersionError makes the errors from looking up a version friendlier. If the version doesn't exist we suggest
+// the closest one that does
+func explainVersionError(ctx context.Context, serverSoftware provider.Provider, version string, err error) error {
+	var notFound *apierror.VersionNotFoundError
+	if !errors.As(err, &notFound) {
+		return err
+	}
+	versions, versionsErr := serverSoftware.Versions(ctx)
+	if versionsErr != nil || len(versions) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s doesn't have Minecraft %s, did you mean %s?", serverSoftware.Name(), version, closestVersion(versions, version))
+}
+
+// closestVersion returns the version that's the fewest edits away from target. Ties go to the newest version
+func closestVersion(versions []string, target string) string {
+	closest := ""
+	closestDistance := -1
+	// versions are oldest first, so going backwards means the first one we find at a distance is the newest
+	for i := len(versions) - 1; i >= 0; i-- {
+		distance := editDistance(versions[i], target)
+		if closestDistance == -1 || distance < closestDistance {
+			closest = versions[i]
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
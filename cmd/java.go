@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"github.com/urfave/cli/v2"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+)
+
+var javaCmd = &cli.Command{
+	Name:        "java",
+	Description: "See the Java runtimes installed on this machine and pick which one the server uses",
+	Usage:       "List the installed Java runtimes and pick one for the server",
+	Before: func(c *cli.Context) error {
+		config := cfg.NewConfig()
+		_ = config.Load(utils.GetServerFolder(".kami.json", c))
+		c.Context = context.WithValue(c.Context, "config", config)
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "List the Java runtimes we can find, the one the server uses is marked with a *",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "format", Usage: "Output format (table, json)", Value: "table"},
+			},
+			Action: func(c *cli.Context) error {
+				format := c.String("format")
+				if format != "table" && format != "json" {
+					return fmt.Errorf("unknown format %s, it has to be table or json", format)
+				}
+				return writeJavaRuntimes(os.Stdout, format, utils.DiscoverJava(javaDirs(c)...), serverJava(c))
+			},
+		},
+		{
+			Name:      "use",
+			Usage:     "Make the server use a Java runtime, either the path to its java or a major version like 21",
+			ArgsUsage: "<path|version>",
+			After: func(c *cli.Context) error {
+				config := c.Context.Value("config").(*cfg.Config)
+				return config.Save(utils.GetServerFolder(".kami.json", c))
+			},
+			Action: func(c *cli.Context) error {
+				config := c.Context.Value("config").(*cfg.Config)
+				if c.NArg() != 1 {
+					return fmt.Errorf("pass the path to a java or a Java version, e.g. java use 21")
+				}
+				chosen, err := findJavaRuntime(c, c.Args().First())
+				if err != nil {
+					return err
+				}
+				log.Printf("Using Java %s (%s)\n", chosen.Version.Version, describeJava(*chosen))
+				config.SetJavaPath(serverRelativePath(c, chosen.Path))
+				// Point our start script at it too, if the server's been set up
+				serverSoftware, err := provider.Get(config.GetSoftware())
+				if err != nil {
+					return err
+				}
+				if _, err := os.Stat(utils.GetStartScript(utils.GetServerFolder("start", c))); err != nil {
+					return nil
+				}
+				if _, ok := serverSoftware.(provider.Installer); ok {
+					log.Printf("%s uses its own run script, make sure it runs %s\n", serverSoftware.Name(), chosen.Path)
+					return nil
+				}
+				_, err = writeStartScript(c, serverSoftware)
+				return err
+			},
+		},
+	},
+}
+
+func init() {
+	rootCmd.Commands = append(rootCmd.Commands, javaCmd)
+}
+
+// findJavaRuntime turns what was passed to java use into a runtime. A version picks the best one we can find
+func findJavaRuntime(c *cli.Context, javaArg string) (*utils.JavaRuntime, error) {
+	major, err := strconv.Atoi(javaArg)
+	if err != nil {
+		// They might have given us the JDK rather than the java inside it
+		if info, err := os.Stat(javaArg); err == nil && info.IsDir() {
+			javaArg = utils.JavaBinary(javaArg)
+		}
+		javaArg, err = filepath.Abs(javaArg)
+		if err != nil {
+			return nil, err
+		}
+		chosen, err := utils.ProbeJava(javaArg)
+		if err != nil {
+			return nil, fmt.Errorf("%s doesn't look like Java: %s", javaArg, err)
+		}
+		chosen.Source = "command line"
+		return &chosen, nil
+	}
+	var matching []utils.JavaRuntime
+	for _, javaRuntime := range utils.DiscoverJava(javaDirs(c)...) {
+		if javaRuntime.Version.Major == major {
+			matching = append(matching, javaRuntime)
+		}
+	}
+	chosen := utils.BestJava(matching, major)
+	if chosen == nil {
+		return nil, fmt.Errorf("couldn't find Java %d, java list shows what we can find", major)
+	}
+	return chosen, nil
+}
+
+type javaRuntimeOutput struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Major   int    `json:"major"`
+	Vendor  string `json:"vendor"`
+	Arch    string `json:"arch"`
+	Source  string `json:"source"`
+	Current bool   `json:"current"`
+}
+
+func writeJavaRuntimes(w io.Writer, format string, runtimes []utils.JavaRuntime, current string) error {
+	// The java on the PATH might have been found somewhere else first, e.g. JAVA_HOME
+	if current == "java" {
+		current, _ = exec.LookPath("java")
+	}
+	isCurrent := func(javaRuntime utils.JavaRuntime) bool {
+		a, errA := filepath.EvalSymlinks(javaRuntime.Path)
+		b, errB := filepath.EvalSymlinks(current)
+		return errA == nil && errB == nil && a == b
+	}
+	if format == "json" {
+		output := make([]javaRuntimeOutput, 0, len(runtimes))
+		for _, javaRuntime := range runtimes {
+			output = append(output, javaRuntimeOutput{Path: javaRuntime.Path, Version: javaRuntime.Version.Version, Major: javaRuntime.Version.Major, Vendor: javaRuntime.Vendor, Arch: javaRuntime.Arch, Source: javaRuntime.Source, Current: isCurrent(javaRuntime)})
+		}
+		return writeJSON(w, output)
+	}
+	if len(runtimes) == 0 {
+		log.Println("Couldn't find any Java, setup will download one")
+		return nil
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "\tVERSION\tVENDOR\tARCH\tSOURCE\tPATH")
+	for _, javaRuntime := range runtimes {
+		marker := ""
+		if isCurrent(javaRuntime) {
+			marker = "*"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", marker, javaRuntime.Version.Version, javaRuntime.Vendor, javaRuntime.Arch, javaRuntime.Source, javaRuntime.Path)
+	}
+	return table.Flush()
+}
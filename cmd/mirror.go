@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/download"
+	"github.com/mja00/kami-chan-server-installer/mirror"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"github.com/urfave/cli/v2"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var mirrorCmd = &cli.Command{
+	Name:        "mirror",
+	Description: "Download everything needed to set up a server into a directory, so it can be installed without internet using --mirror",
+	Usage:       "Make a mirror for offline installs",
+	ArgsUsage:   "<directory>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "software", Usage: "Server software to mirror (" + strings.Join(provider.Names(), ", ") + ")", Value: "paper"},
+		&cli.StringFlag{Name: "minecraft-version", Usage: "Minecraft version to mirror, e.g. latest, latest-experimental, 1.21 or 1.21.4", Value: "latest"},
+		&cli.BoolFlag{Name: "allow-experimental-builds", Aliases: []string{"e"}, Usage: "Allow experimental builds to be used"},
+		&cli.StringFlag{Name: "channel", Usage: "Which builds to mirror (" + strings.Join(provider.ChannelPolicies, ", ") + ")", Value: "default"},
+		&cli.StringFlag{Name: "build", Usage: "Mirror exactly this build"},
+		&cli.IntFlag{Name: "java-version", Usage: "Java version to mirror. Defaults to the one the Minecraft version needs"},
+		&cli.StringSliceFlag{Name: "java-os", Usage: "OS the servers using the mirror run on (linux, darwin, windows)", Value: cli.NewStringSlice(runtime.GOOS)},
+		&cli.StringFlag{Name: "java-arch", Usage: "Architecture the servers using the mirror run on (x64, aarch64). Defaults to this machine's"},
+		&cli.StringSliceFlag{Name: "url", Usage: "Extra files to mirror, such as plugins"},
+	},
+	Action: func(c *cli.Context) error {
+		root := c.Args().First()
+		if root == "" {
+			return fmt.Errorf("you need to give a directory to put the mirror in")
+		}
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return err
+		}
+		// Everything goes straight to the network through the recorder, the caches would keep things out of the mirror
+		recorder := &mirror.Recorder{Root: root, Transport: http.DefaultTransport}
+		client := &http.Client{Timeout: apiclient.Timeout, Transport: recorder}
+		// Downloads have their own timeout, download.Timeout
+		downloader := download.New()
+		downloader.Client = &http.Client{Transport: recorder}
+		// The files themselves only matter for what they leave in the mirror
+		tempDir, err := os.MkdirTemp("", "kami-mirror")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tempDir)
+
+		serverSoftware, err := provider.GetWithClient(c.String("software"), client)
+		if err != nil {
+			return err
+		}
+		policy, err := provider.ChannelPolicyFor(serverSoftware, c.String("channel"))
+		if err != nil {
+			return err
+		}
+		version, err := provider.ResolveVersion(c.Context, serverSoftware, c.String("minecraft-version"))
+		if err != nil {
+			return err
+		}
+		if c.Bool("allow-experimental-builds") {
+			policy = provider.ChannelExperimental
+		}
+		var build *provider.Build
+		if c.IsSet("build") {
+			build, err = provider.FindBuild(c.Context, serverSoftware, version, c.String("build"))
+		} else {
+			build, err = provider.LatestBuild(c.Context, serverSoftware, version, policy)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Mirroring %s %s build %s...\n", serverSoftware.Name(), version, build.ID)
+		serverDownload, err := serverSoftware.ResolveDownload(c.Context, version, build.ID)
+		if err != nil {
+			return err
+		}
+		request := download.Request{
+			URL:         serverDownload.URL,
+			Dest:        filepath.Join(tempDir, provider.JarName(serverSoftware)),
+			Description: "Downloading " + serverDownload.FileName,
+		}
+		if serverDownload.Checksum != nil {
+			request.Algorithm, request.Checksum = serverDownload.Checksum.Algorithm, serverDownload.Checksum.Value
+		}
+		err = downloader.Download(c.Context, request)
+		if err != nil {
+			return err
+		}
+		if _, ok := serverSoftware.(provider.Installer); ok {
+			log.Printf("Warning: the %s installer downloads its own libraries, those aren't in the mirror\n", serverSoftware.Name())
+		}
+
+		javaVersion := c.Int("java-version")
+		if javaVersion == 0 {
+			javaVersion, err = provider.RequiredJava(c.Context, serverSoftware, version)
+			if err != nil {
+				return err
+			}
+		}
+		javaArch := c.String("java-arch")
+		if javaArch == "" {
+			javaArch = utils.GetArch()
+		}
+		for _, goos := range c.StringSlice("java-os") {
+			log.Printf("Mirroring Java %d for %s...\n", javaVersion, goos)
+			// Both the installer and the portable JDK, servers could be using either
+			for _, correttoURL := range []func(int, string, string) (string, error){utils.CorrettoURL, utils.CorrettoArchiveURL} {
+				javaURL, err := correttoURL(javaVersion, goos, javaArch)
+				if err != nil {
+					return err
+				}
+				request, err := utils.CorrettoRequest(c.Context, client, javaURL, filepath.Join(tempDir, path.Base(javaURL)))
+				if err != nil {
+					return err
+				}
+				err = downloader.Download(c.Context, request)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for i, extra := range c.StringSlice("url") {
+			// Two URLs can end in the same name, so number them
+			err = downloader.Download(c.Context, download.Request{
+				URL:         extra,
+				Dest:        filepath.Join(tempDir, fmt.Sprintf("extra-%d", i)),
+				Description: "Downloading " + path.Base(extra),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("Mirror is ready, copy %s to your servers and run with --mirror %s\n", root, root)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.Commands = append(rootCmd.Commands, mirrorCmd)
+}
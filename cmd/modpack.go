@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/lock"
+	"github.com/mja00/kami-chan-server-installer/modpack"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"github.com/urfave/cli/v2"
+	"log"
+	"os"
+)
+
+var importModpackCmd = &cli.Command{
+	Name:        "import-modpack",
+	Description: "Set the server up from a Modrinth modpack (.mrpack) or a CurseForge server pack (.zip)",
+	Usage:       "Set the server up from a modpack",
+	ArgsUsage:   "<file.mrpack|server-pack.zip>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "accept-eula", Usage: "Accept the Minecraft EULA"},
+	},
+	Before: func(c *cli.Context) error {
+		config := cfg.NewConfig()
+		_ = config.Load(utils.GetServerFolder(".kami.json", c))
+		c.Context = context.WithValue(c.Context, "config", config)
+		return nil
+	},
+	After: func(c *cli.Context) error {
+		config := c.Context.Value("config").(*cfg.Config)
+		return config.Save(utils.GetServerFolder(".kami.json", c))
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("usage: import-modpack <file.mrpack|server-pack.zip>")
+		}
+		config := c.Context.Value("config").(*cfg.Config)
+		pack, err := modpack.Open(c.Args().First())
+		if err != nil {
+			return err
+		}
+		defer pack.Close()
+		log.Printf("Importing %s %s...\n", pack.Name(), pack.Version())
+		software, loaderVersion, err := pack.Loader()
+		if err != nil {
+			return err
+		}
+		version := pack.MinecraftVersion()
+		serverSoftware, err := provider.Get(software)
+		if err != nil {
+			return err
+		}
+		requiredJavaVersion, err := provider.RequiredJava(c.Context, serverSoftware, version)
+		if err != nil {
+			return err
+		}
+		jdk, err := ensureJava(c, requiredJavaVersion, nil)
+		if err != nil {
+			return err
+		}
+		// Install the loader the pack wants
+		err = archiveInstalled(c, config)
+		if err != nil {
+			return err
+		}
+		log.Printf("Downloading %s %s for Minecraft %s...\n", software, loaderVersion, version)
+		download, err := installBuild(c, serverSoftware, version, loaderVersion)
+		if err != nil {
+			return err
+		}
+		recordInstall(config, serverSoftware, version, loaderVersion, download)
+		err = lockInstall(c, serverSoftware, version, loaderVersion, download, jdk)
+		if err != nil {
+			return err
+		}
+		// Then everything in the pack
+		serverDir := utils.GetServerFolder("", c)
+		files, err := pack.Install(c.Context, serverDir)
+		if err != nil {
+			return err
+		}
+		// If this is an upgrade of the same pack, get rid of anything the new version doesn't have anymore
+		previous := config.GetModpack()
+		if previous != nil && previous.Source == pack.Source() && previous.Name == pack.Name() {
+			log.Printf("Upgrading from %s %s\n", previous.Name, previous.Version)
+			err = modpack.RemoveStaleFiles(serverDir, previous.Files, files)
+			if err != nil {
+				return err
+			}
+		}
+		err = lockPackFiles(c, pack, previous, files)
+		if err != nil {
+			return err
+		}
+		config.SetModpack(&cfg.Modpack{
+			Source:  pack.Source(),
+			Name:    pack.Name(),
+			Version: pack.Version(),
+			Files:   files,
+		})
+		startScriptLocation, err := writeStartScript(c, serverSoftware)
+		if err != nil {
+			return err
+		}
+		if c.Bool("accept-eula") {
+			err = os.WriteFile(utils.GetServerFolder("eula.txt", c), []byte("eula=true"), 0644)
+			if err != nil {
+				return err
+			}
+		} else {
+			log.Println("Remember to accept the Minecraft EULA by setting eula=true in eula.txt before starting the server")
+		}
+		log.Printf("Imported %s %s!\n", pack.Name(), pack.Version())
+		log.Printf("The start script is located at: %s", startScriptLocation)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.Commands = append(rootCmd.Commands, importModpackCmd)
+}
+
+// lockPackFiles puts every file the pack installed in kami.lock, dropping the ones from the version it replaced
+func lockPackFiles(c *cli.Context, pack modpack.Pack, previous *cfg.Modpack, files []string) error {
+	lockPath := utils.GetServerFolder(lock.FileName, c)
+	lockfile, err := lock.LoadOrNew(lockPath)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		for _, path := range previous.Files {
+			lockfile.Remove(path)
+		}
+	}
+	for _, path := range files {
+		target, err := utils.SafeJoin(utils.GetServerFolder("", c), path)
+		if err != nil {
+			return err
+		}
+		sha256, err := utils.GetSha256Hash(target)
+		if err != nil {
+			return err
+		}
+		lockfile.Set(lock.Artifact{Name: path, Path: path, URL: pack.URL(path), SHA256: sha256})
+	}
+	return lockfile.Save(lockPath)
+}
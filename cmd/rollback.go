@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/archive"
+	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"github.com/urfave/cli/v2"
+	"log"
+	"os"
+	"time"
+)
+
+var rollbackCmd = &cli.Command{
+	Name:        "rollback",
+	Description: "Roll the server back to a previously installed build",
+	Usage:       "Roll the server back to a previously installed build",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "build", Usage: "Build to roll back to. Defaults to the previously installed build"},
+		&cli.StringFlag{Name: "minecraft-version", Usage: "Minecraft version of the build to roll back to"},
+		&cli.BoolFlag{Name: "list", Usage: "List the builds that can be rolled back to"},
+	},
+	Before: func(c *cli.Context) error {
+		config := cfg.NewConfig()
+		_ = config.Load(utils.GetServerFolder(".kami.json", c))
+		c.Context = context.WithValue(c.Context, "config", config)
+		return nil
+	},
+	After: func(c *cli.Context) error {
+		config := c.Context.Value("config").(*cfg.Config)
+		return config.Save(utils.GetServerFolder(".kami.json", c))
+	},
+	Action: func(c *cli.Context) error {
+		config := c.Context.Value("config").(*cfg.Config)
+		serverDir := utils.GetServerFolder("", c)
+		if c.Bool("list") {
+			jars, err := archive.List(serverDir)
+			if err != nil {
+				return err
+			}
+			if len(jars) == 0 {
+				log.Println("There are no builds to roll back to")
+				return nil
+			}
+			for _, jar := range jars {
+				fmt.Printf("%s %s build %s (archived %s)\n", jar.Software, jar.Version, jar.Build, jar.ModTime.Format("2006-01-02 15:04"))
+			}
+			return nil
+		}
+		currentVersion := config.GetMinecraftVersion()
+		currentBuild := config.GetPaperBuild()
+		// By default we go back to whatever was installed before the current build
+		targetBuild := config.GetLastPaperBuild()
+		targetVersion := config.GetLastMinecraftVersion()
+		if c.IsSet("build") {
+			targetBuild = c.String("build")
+			targetVersion = currentVersion
+		}
+		if c.IsSet("minecraft-version") {
+			targetVersion = c.String("minecraft-version")
+		}
+		if targetBuild == "" {
+			return fmt.Errorf("there is no previous build recorded, use --build to pick one (see --list)")
+		}
+		if targetVersion == currentVersion && targetBuild == currentBuild {
+			return fmt.Errorf("build %s is already installed", targetBuild)
+		}
+		serverSoftware, err := provider.Get(config.GetSoftware())
+		if err != nil {
+			return err
+		}
+		jar, err := archive.Find(serverDir, serverSoftware.Name(), targetVersion, targetBuild)
+		if err != nil {
+			return err
+		}
+		// Make sure the jar we kept is actually the build it claims to be
+		log.Printf("Verifying %s %s build %s...\n", jar.Software, jar.Version, jar.Build)
+		download, err := serverSoftware.ResolveDownload(c.Context, jar.Version, jar.Build)
+		if err != nil {
+			return err
+		}
+		// Software that doesn't publish hashes gets checked against the one we took when the jar was installed
+		if download.Checksum == nil {
+			download.Checksum = provider.ParseChecksum(jar.Checksum)
+		}
+		if download.Checksum == nil {
+			return fmt.Errorf("there's no checksum to check the archived %s build %s against, refusing to roll back", jar.Software, jar.Build)
+		}
+		if err := provider.VerifyFile(jar.Path, download.Checksum); err != nil {
+			return fmt.Errorf("archived jar doesn't match build %s, refusing to roll back: %s", jar.Build, err)
+		}
+		// Bump the jar we're restoring so it doesn't get pruned when the current one is archived
+		now := time.Now()
+		_ = os.Chtimes(jar.Path, now, now)
+		// Keep the current jar so we can roll forward again
+		if currentVersion != "" && currentBuild != "" {
+			err = archive.Store(serverDir, utils.GetServerFolder(provider.JarName(serverSoftware), c), serverSoftware.Name(), currentVersion, currentBuild, config.GetBuildChecksum())
+			if err != nil {
+				return err
+			}
+		}
+		err = utils.CopyFile(jar.Path, utils.GetServerFolder(provider.JarName(serverSoftware), c))
+		if err != nil {
+			return err
+		}
+		// What we kept for Forge is the installer, so it needs running again
+		err = runInstaller(c, serverSoftware)
+		if err != nil {
+			return err
+		}
+		config.SetLastMinecraftVersion(currentVersion)
+		config.SetLastPaperBuild(currentBuild)
+		config.SetMinecraftVersion(jar.Version)
+		config.SetPaperBuild(jar.Build)
+		config.SetLoaderVersion(provider.LoaderVersion(serverSoftware, jar.Build))
+		config.SetBuildChecksum(download.Checksum.String())
+		err = lockInstall(c, serverSoftware, jar.Version, jar.Build, download, nil)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rolled back from Minecraft %s (build %s) to Minecraft %s (build %s)\n", currentVersion, currentBuild, jar.Version, jar.Build)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.Commands = append(rootCmd.Commands, rollbackCmd)
+}
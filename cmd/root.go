@@ -1,10 +1,22 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/fatih/color"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/cache"
+	"github.com/mja00/kami-chan-server-installer/download"
+	"github.com/mja00/kami-chan-server-installer/mirror"
+	"github.com/mja00/kami-chan-server-installer/update"
 	"github.com/urfave/cli/v2"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var rootCmd = &cli.App{
@@ -19,19 +31,89 @@ var rootCmd = &cli.App{
 		&cli.BoolFlag{Name: "verbose", Usage: "Enable verbose mode"},
 		&cli.StringFlag{Name: "server-dir", Usage: "Server directory", Value: "server"},
 		&cli.BoolFlag{Name: "install-java-please", Usage: "This will install Java for you anyways on Linux"},
+		&cli.BoolFlag{Name: "portable-java", Usage: "Download a JDK just for this server instead of installing Java system wide. Defaults to on for Linux (unless --install-java-please is set), as it doesn't need root, and off everywhere else"},
+		&cli.StringFlag{Name: "java-dir", Usage: "Where portable JDKs go, point servers at the same folder to share them. Defaults to the runtime folder in the server folder", EnvVars: []string{"KAMI_JAVA_DIR"}},
+		&cli.StringFlag{Name: "cache-dir", Usage: "Where downloads are cached. Defaults to the user's cache directory", EnvVars: []string{"KAMI_CACHE_DIR"}},
+		&cli.BoolFlag{Name: "no-cache", Usage: "Don't use the download cache or cached API responses"},
+		&cli.StringFlag{Name: "mirror", Usage: "Download everything from a mirror made with the mirror command, either a directory or a URL"},
+		&cli.DurationFlag{Name: "timeout", Usage: "How long a single API request can take", Value: 30 * time.Second},
+		&cli.DurationFlag{Name: "download-timeout", Usage: "How long a single download attempt can take, 0 means no limit"},
 	},
 	Version:        Version,
 	DefaultCommand: "setup",
 	Before: func(cCtx *cli.Context) error {
+		cache.Dir = cCtx.String("cache-dir")
+		cache.Disabled = cCtx.Bool("no-cache")
+		apiclient.Timeout = cCtx.Duration("timeout")
+		download.Timeout = cCtx.Duration("download-timeout")
+		if cCtx.IsSet("mirror") {
+			// Every API client uses the default transport, so this sends all of them to the mirror
+			transport, err := mirror.NewTransport(cCtx.String("mirror"))
+			if err != nil {
+				return err
+			}
+			http.DefaultTransport = transport
+			log.Printf("Using the mirror at %s\n", cCtx.String("mirror"))
+			// A mirror is for setting up without internet, there's no GitHub to ask
+			return nil
+		}
+		// Only now the caches, timeout and mirror are set up, the check goes through them too
+		checkForUpdates(cCtx.Context)
 		return nil
 	},
 }
 
+// checkForUpdates lets the user know if there's a newer release, this shouldn't hold up the installer if GitHub is slow
+func checkForUpdates(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	updateAvailable, err := update.CheckForUpdates(ctx)
+	if err != nil {
+		log.Println("Error checking for updates:", err)
+	}
+	if updateAvailable {
+		color.Set(color.FgGreen)
+		log.Println("An update is available!")
+		url := update.GetUpdateURL(ctx)
+		if url == "" {
+			log.Println("Error downloading update")
+		} else {
+			//log.Println("Downloading update from:", url)
+			//downloadErr := update.DownloadUpdate(ctx, url)
+			//if downloadErr != nil {
+			//	log.Println("Error downloading update:", downloadErr)
+			//}
+			//installErr := update.InstallUpdate()
+			//if installErr != nil {
+			//	log.Println("Error installing update:", installErr)
+			//}
+			//log.Println("Update complete!")
+			//os.Exit(0)
+			// For now just print the URL. We support downloading the update and installing it. Just it's a bit janky.
+			log.Println("Download the update from:", url)
+		}
+		color.Unset()
+	}
+}
+
 var Version = "dev"
 var Commit = "none"
 
 func Run() {
-	if err := rootCmd.Run(os.Args); err != nil {
+	// Ctrl-C cancels whatever we're doing so downloads can clean up after themselves
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// Once we've been asked to stop, a second Ctrl-C kills us straight away
+		<-ctx.Done()
+		stop()
+	}()
+	if err := rootCmd.RunContext(ctx, os.Args); err != nil {
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			// 130 is what shells use for a command stopped by Ctrl-C
+			cli.HandleExitCoder(cli.Exit("Cancelled", 130))
+			return
+		}
 		log.Println(err)
 		// Then hold the terminal open so the user can read the error
 		fmt.Println("Press enter key to exit...")
@@ -5,27 +5,29 @@ import (
 	"fmt"
 	"github.com/charmbracelet/huh"
 	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/lock"
 	"github.com/mja00/kami-chan-server-installer/minecraft"
-	"github.com/mja00/kami-chan-server-installer/paper"
+	"github.com/mja00/kami-chan-server-installer/provider"
 	"github.com/mja00/kami-chan-server-installer/utils"
-	"github.com/pbnjay/memory"
 	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
 	"log"
-	"math"
 	"os"
 	"os/exec"
-	"strconv"
+	"path/filepath"
 	"strings"
 )
 
 var (
 	// This will be used for huh
-	minecraftVersion  = "latest"
-	serverName        = "A Minecraft Server"
-	whitelist         = false
-	acceptEULA        = false
-	allowExperimental = false
+	software         = "paper"
+	minecraftVersion = "latest"
+	serverName       = "A Minecraft Server"
+	whitelist        = false
+	acceptEULA       = false
+	channel          = "default"
+	// What was typed in when the version isn't one from the list
+	customVersion = ""
 )
 
 var setupCmd = &cli.Command{
@@ -34,6 +36,11 @@ var setupCmd = &cli.Command{
 	Usage:       "Setup and install the server",
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "skip-prompts", Usage: "Skip setup prompts. This will only install Java and the jar file"},
+		&cli.StringFlag{Name: "software", Usage: "Server software to install (" + strings.Join(provider.Names(), ", ") + ")"},
+		&cli.StringFlag{Name: "minecraft-version", Usage: "Minecraft version to install, e.g. latest, latest-experimental, 1.21, ~1.21.3 or 1.21.4"},
+		&cli.StringFlag{Name: "channel", Usage: "Which builds to install (" + strings.Join(provider.ChannelPolicies, ", ") + ")"},
+		&cli.StringFlag{Name: "build", Usage: "Install exactly this build and keep the server on it when updating"},
+		&cli.BoolFlag{Name: "frozen", Usage: "Install exactly what " + lock.FileName + " says, failing if anything doesn't match it"},
 	},
 	Before: func(c *cli.Context) error {
 		utils.PrintOSWarnings()
@@ -43,12 +50,50 @@ var setupCmd = &cli.Command{
 		_ = config.Load(utils.GetServerFolder(".kami.json", c))
 		// Add the config to the context
 		c.Context = context.WithValue(c.Context, "config", config)
+		// Stick with the software that's already installed unless we've been told otherwise
+		if c.Bool("frozen") {
+			// The lockfile decides what gets installed
+			lockfile, err := lock.Load(utils.GetServerFolder(lock.FileName, c))
+			if err != nil {
+				return fmt.Errorf("--frozen needs a %s in the server folder: %s", lock.FileName, err)
+			}
+			if c.IsSet("software") || c.IsSet("minecraft-version") || c.IsSet("build") {
+				return fmt.Errorf("--frozen can't be used with --software, --minecraft-version or --build, they come from %s", lock.FileName)
+			}
+			c.Context = context.WithValue(c.Context, "lockfile", lockfile)
+			software = lockfile.Software
+		} else if c.IsSet("software") {
+			software = c.String("software")
+		} else if config.Software != "" {
+			software = config.Software
+		}
+		if _, err := provider.Get(software); err != nil {
+			return err
+		}
+		if c.IsSet("minecraft-version") {
+			minecraftVersion = c.String("minecraft-version")
+		}
+		if lockfile, ok := c.Context.Value("lockfile").(*lock.Lockfile); ok {
+			minecraftVersion = lockfile.MinecraftVersion
+		}
+		if err := provider.ValidateVersionSelector(minecraftVersion); err != nil {
+			return err
+		}
+		// Same for the channel, the flag wins over whatever was picked last time
+		if c.IsSet("channel") {
+			channel = c.String("channel")
+		} else {
+			channel = config.GetChannel()
+		}
+		if _, err := provider.ParseChannelPolicy(channel); err != nil {
+			return err
+		}
 		// If debug pring all the flags
 		if c.Bool("debug") {
 			log.Println("Debug mode enabled")
 		}
 		for !c.Bool("skip-prompts") {
-			err := prompt()
+			err := prompt(c.Context)
 			if err != nil {
 				// If the error is that we can't open a TTY, then just break from this loop. We'll use default values
 				// error: huh: could not open a new TTY: open /dev/tty: no such device or address
@@ -60,8 +105,9 @@ var setupCmd = &cli.Command{
 			}
 			// Print out our settings
 			// TODO: Replace this with a nicer output. Probably just some bubbletea fanciness
+			fmt.Printf("Server Software: %s\n", software)
 			fmt.Printf("Minecraft Version: %s\n", minecraftVersion)
-			fmt.Printf("Allow Experimental Builds: %t\n", allowExperimental)
+			fmt.Printf("Build Channel: %s\n", channel)
 			fmt.Printf("Server Name: %s\n", serverName)
 			fmt.Printf("Whitelist: %t\n", whitelist)
 			// Ask if they want to save these settings
@@ -77,16 +123,6 @@ var setupCmd = &cli.Command{
 		}
 		return nil
 	},
-	After: func(c *cli.Context) error {
-		log.Println("Setup complete!")
-		// Save the config
-		config := c.Context.Value("config").(*cfg.Config)
-		err := config.Save(utils.GetServerFolder(".kami.json", c))
-		if err != nil {
-			return err
-		}
-		return nil
-	},
 	Action: func(c *cli.Context) error {
 		// If they didn't already accept the EULA, then we need to prompt them to do so, unless we're skipping prompts, then error
 		if !acceptEULA && !c.Bool("skip-prompts") {
@@ -95,64 +131,68 @@ var setupCmd = &cli.Command{
 		}
 		// Grab the config
 		config := c.Context.Value("config").(*cfg.Config)
-		// Check for Java
-		log.Println("Checking for Java...")
-		javaVersion, err := utils.GetJavaVersion()
+		// Work out exactly what we're installing first, the Java version we need depends on it
+		frozen, _ := c.Context.Value("lockfile").(*lock.Lockfile)
+		if frozen != nil {
+			software = frozen.Software
+		}
+		serverSoftware, err := provider.Get(software)
 		if err != nil {
 			return err
 		}
-		log.Printf("Java version: %s\n", javaVersion.Version)
-		// TODO: When Paper API v3 is released, we can check the recommended java version there. For now, we'll do a really shit check
-		var requiredJavaVersion int
-		if minecraftVersion == "latest" {
-			// TODO: Don't hardcode this
-			requiredJavaVersion = 21
+		var version, buildID string
+		if frozen != nil {
+			version, buildID = frozen.MinecraftVersion, frozen.Build
+			log.Printf("Installing %s %s build %s from %s\n", software, version, buildID, lock.FileName)
 		} else {
-			requiredJavaVersion, err = utils.MCVersionToJavaMajor(minecraftVersion)
+			var build *provider.Build
+			version, build, err = pickBuild(c, serverSoftware)
 			if err != nil {
 				return err
 			}
+			buildID = build.ID
 		}
-		if javaVersion.Major < requiredJavaVersion {
-			log.Println("Java version is too low, downloading...")
-			fileLoc, downloadErr := utils.DownloadJava(requiredJavaVersion, c)
-			if downloadErr != nil {
-				return downloadErr
-			}
-			log.Println("Installing Java...")
-			err = utils.InstallJava(fileLoc, c)
-			if err != nil {
-				return err
-			}
-			// Re-verify the Java version
-			javaVersion, err = utils.GetJavaVersion()
-			if err != nil {
-				return err
-			}
-			// If we're still too low then something went wrong, error and let the user figure it out
-			if javaVersion.Major < requiredJavaVersion {
-				return fmt.Errorf("java version must be at least %d", requiredJavaVersion)
-			}
+		requiredJavaVersion, err := provider.RequiredJava(c.Context, serverSoftware, version)
+		if err != nil {
+			return explainVersionError(c.Context, serverSoftware, version, err)
+		}
+		jdk, err := ensureJava(c, requiredJavaVersion, frozen)
+		if err != nil {
+			return err
 		}
 		// Create a server folder
 		log.Println("Downloading server files...")
-		// Download our Paper jar
-		paperAPI := paper.NewPaperAPI()
-		if minecraftVersion == "latest" {
-			version, build, err := paperAPI.DownloadLatestBuild("paper", utils.GetServerFolder("paper.jar", c), allowExperimental)
+		// If there's already a jar installed, keep a copy of it so we can roll back
+		err = archiveInstalled(c, config)
+		if err != nil {
+			return err
+		}
+		var download *provider.Download
+		if frozen != nil {
+			download, err = installLocked(c, serverSoftware, frozen)
 			if err != nil {
 				return err
 			}
-			config.SetMinecraftVersion(version)
-			config.SetPaperBuild(strconv.Itoa(build))
+			recordInstall(config, serverSoftware, version, buildID, download)
 		} else {
-			// Download the specific version
-			version, build, err := paperAPI.DownloadLatestBuildForVersion("paper", minecraftVersion, utils.GetServerFolder("paper.jar", c), allowExperimental)
+			// Download our server jar
+			log.Printf("Downloading %s %s build %s...\n", software, version, buildID)
+			download, err = installBuild(c, serverSoftware, version, buildID)
+			if err != nil {
+				return err
+			}
+			recordInstall(config, serverSoftware, version, buildID, download)
+			// Only once it's installed, pinning a build we never got would stop update from ever installing it
+			config.SetChannel(channel)
+			if c.IsSet("build") {
+				config.SetPinnedBuild(buildID)
+			} else {
+				config.SetPinnedBuild("")
+			}
+			err = lockInstall(c, serverSoftware, version, buildID, download, jdk)
 			if err != nil {
 				return err
 			}
-			config.SetMinecraftVersion(version)
-			config.SetPaperBuild(strconv.Itoa(build))
 		}
 		// Check if the eula.txt file already exists and if the eula is already accepted
 		eulaFile, err := os.ReadFile(utils.GetServerFolder("eula.txt", c))
@@ -185,18 +225,16 @@ var setupCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
-		// Get the RAM of the machine
-		totalRAM := float64(memory.TotalMemory())
-		// At most we'll only ever set the script to use 10GB of RAM
-		// Otherwise we'll use 75% of the total RAM
-		ramAmount := int(math.Min(float64(10*1024*1024*1024), totalRAM*0.75))
-		// Conver the amount to MB
-		ramAmount = ramAmount / 1024 / 1024
-		err = utils.WriteStartScript(utils.GetServerFolder("start", c), ramAmount, c)
+		startScriptLocation, err := writeStartScript(c, serverSoftware)
 		if err != nil {
 			return err
 		}
-		startScriptLocation := utils.GetStartScript(utils.GetServerFolder("start", c))
+		// Only save once we know it worked, a failed setup shouldn't leave the config pointing at a build we don't have
+		err = config.Save(utils.GetServerFolder(".kami.json", c))
+		if err != nil {
+			return err
+		}
+		log.Println("Setup complete!")
 		// Ask the user if they want to start the server now or not
 		if !c.Bool("skip-prompts") {
 			var startServer bool
@@ -207,7 +245,7 @@ var setupCmd = &cli.Command{
 				Run()
 			if startServer {
 				// Start the server
-				startScript := utils.GetStartScript("start")
+				startScript := filepath.Base(startScriptLocation)
 				log.Println("Starting the server...")
 				pwd, err := os.Getwd()
 				if err != nil {
@@ -240,41 +278,55 @@ func init() {
 	rootCmd.Commands = append(rootCmd.Commands, setupCmd)
 }
 
-func prompt() error {
-	// Before we do anything, lets get some info from the user
-	form := huh.NewForm(
+// pickBuild works out the Minecraft version and build to install from the selector, channel and --build
+func pickBuild(c *cli.Context, serverSoftware provider.Provider) (string, *provider.Build, error) {
+	policy, err := provider.ChannelPolicyFor(serverSoftware, channel)
+	if err != nil {
+		return "", nil, err
+	}
+	version, err := provider.ResolveVersion(c.Context, serverSoftware, minecraftVersion)
+	if err != nil {
+		return "", nil, err
+	}
+	if version != minecraftVersion {
+		log.Printf("Using Minecraft %s for %s\n", version, minecraftVersion)
+	}
+	var build *provider.Build
+	if c.IsSet("build") {
+		// Check the build actually exists before we start downloading anything
+		build, err = provider.FindBuild(c.Context, serverSoftware, version, c.String("build"))
+	} else {
+		build, err = provider.LatestBuild(c.Context, serverSoftware, version, policy)
+	}
+	if err != nil {
+		return "", nil, explainVersionError(c.Context, serverSoftware, version, err)
+	}
+	return version, build, nil
+}
+
+// otherVersion is the option in the version picker for typing in a version or selector
+const otherVersion = "other"
+
+func prompt(ctx context.Context) error {
+	// The versions we can offer depend on the software, so that has to be picked first
+	err := huh.NewSelect[string]().
+		Title("Server Software").
+		Description("Which server software do you want to use?").
+		Options(huh.NewOptions(provider.Names()...)...).
+		Value(&software).
+		Run()
+	if err != nil {
+		return err
+	}
+	groups := versionGroups(ctx)
+	groups = append(groups,
 		huh.NewGroup(
-			huh.NewInput().
-				Title("Minecraft Version").
-				Description("What version of Minecraft do you want to use?").
-				Value(&minecraftVersion).
-				Validate(func(v string) error {
-					if v != "latest" {
-						// Quick and dirty check to see if it's valid
-						// If there is no "." thne it's definitely invalid
-						if !strings.Contains(v, ".") {
-							return fmt.Errorf("invalid Minecraft version: %s", v)
-						}
-						// If there is a "." then we need to make sure it's valid
-						split := strings.Split(v, ".")
-						if len(split) < 2 || len(split) > 3 {
-							return fmt.Errorf("invalid Minecraft version: %s", v)
-						}
-						// So we know it's at least 2 parts, make sure all the parts are numbers
-						for _, part := range split {
-							if _, err := strconv.Atoi(part); err != nil {
-								return fmt.Errorf("invalid Minecraft version: %s", v)
-							}
-						}
-						// Good enough, we're good
-					}
-					return nil
-				}),
-			// Allow experimental builds
-			huh.NewConfirm().
-				Title("Allow Experimental Builds").
-				Description("Do you want to allow experimental builds of Paper to be used?").
-				Value(&allowExperimental),
+			// Which builds we're allowed to pick
+			huh.NewSelect[string]().
+				Title("Build Channel").
+				Description("promoted only uses recommended builds, default uses the newest stable build and experimental uses the newest build").
+				Options(huh.NewOptions(provider.ChannelPolicies...)...).
+				Value(&channel),
 		),
 		huh.NewGroup(
 			// Server name
@@ -299,9 +351,106 @@ func prompt() error {
 		),
 	)
 	// Run the form, we'll use the results in the action
-	err := form.Run()
+	err = huh.NewForm(groups...).Run()
 	if err != nil {
 		return err
 	}
+	if minecraftVersion == otherVersion {
+		minecraftVersion = customVersion
+	}
 	return nil
 }
+
+// versionGroups asks for the Minecraft version. Normally it's picked from the versions the software actually has,
+// but if we can't get them it has to be typed in
+func versionGroups(ctx context.Context) []*huh.Group {
+	log.Printf("Getting the versions %s has...\n", software)
+	serverSoftware, err := provider.Get(software)
+	var versions []provider.VersionInfo
+	if err == nil {
+		versions, err = provider.DescribeVersions(ctx, serverSoftware)
+	}
+	if err != nil || len(versions) == 0 {
+		if err != nil {
+			log.Printf("Couldn't get the versions, you'll have to type one in: %s\n", err)
+		}
+		return []*huh.Group{
+			huh.NewGroup(
+				huh.NewInput().
+					Title("Minecraft Version").
+					Description("latest, latest-stable, latest-experimental, a version line like 1.21 or an exact version like 1.21.4").
+					Value(&minecraftVersion).
+					Validate(provider.ValidateVersionSelector),
+			),
+		}
+	}
+	names := make([]string, 0, len(versions))
+	// latest skips versions that only have experimental builds, if we know which those are
+	latest := versions[len(versions)-1].Version
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Stable == nil || *versions[i].Stable {
+			latest = versions[i].Version
+			break
+		}
+	}
+	options := []huh.Option[string]{
+		huh.NewOption(fmt.Sprintf("latest (currently %s)", latest), "latest"),
+		huh.NewOption(fmt.Sprintf("latest-experimental (currently %s, even if it only has experimental builds)", versions[len(versions)-1].Version), "latest-experimental"),
+	}
+	// Newest first, that's what most people are after
+	for i := len(versions) - 1; i >= 0; i-- {
+		names = append(names, versions[i].Version)
+		options = append(options, huh.NewOption(describeVersion(versions[i]), versions[i].Version))
+	}
+	options = append(options, huh.NewOption("Something else, like 1.21 or ~1.20.4", otherVersion))
+	// Selectors from --minecraft-version or last time round aren't in the list, so they start off in the text box
+	known := minecraftVersion == otherVersion
+	for _, option := range options {
+		known = known || option.Value == minecraftVersion
+	}
+	if !known {
+		customVersion = minecraftVersion
+		minecraftVersion = otherVersion
+	}
+	return []*huh.Group{
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Minecraft Version").
+				Description("Which version do you want? Press / to search").
+				Options(options...).
+				Filtering(true).
+				Height(12).
+				Value(&minecraftVersion),
+		),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Minecraft Version").
+				Description("latest-stable, a version line like 1.21, a range like ~1.20.4 or an exact version like 1.21.4").
+				Value(&customVersion).
+				Validate(func(selector string) error {
+					return provider.ValidateVersionSelectorAgainst(names, selector)
+				}),
+		).WithHideFunc(func() bool {
+			return minecraftVersion != otherVersion
+		}),
+	}
+}
+
+// describeVersion is how a version shows up in the picker, e.g. 1.21.4 (stable builds, Java 21)
+func describeVersion(version provider.VersionInfo) string {
+	var details []string
+	if version.Stable != nil {
+		if *version.Stable {
+			details = append(details, "stable builds")
+		} else {
+			details = append(details, "experimental builds only")
+		}
+	}
+	if version.Java != 0 {
+		details = append(details, fmt.Sprintf("Java %d", version.Java))
+	}
+	if len(details) == 0 {
+		return version.Version
+	}
+	return fmt.Sprintf("%s (%s)", version.Version, strings.Join(details, ", "))
+}
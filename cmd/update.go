@@ -1,8 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/lock"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
 	"github.com/urfave/cli/v2"
 	"log"
+	"os"
+	"strings"
 )
 
 var updateCmd = &cli.Command{
@@ -10,18 +18,35 @@ var updateCmd = &cli.Command{
 	Description: "Update the server",
 	Usage:       "Update the server",
 	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "allow-experimental-builds", Aliases: []string{"e"}, Usage: "Allow experimental builds of Paper to be used"},
+		&cli.BoolFlag{Name: "allow-experimental-builds", Aliases: []string{"e"}, Usage: "Allow experimental builds to be used for this update"},
+		&cli.StringFlag{Name: "channel", Usage: "Which builds to update to from now on (" + strings.Join(provider.ChannelPolicies, ", ") + ")"},
+		&cli.StringFlag{Name: "build", Usage: "Update to exactly this build and stay on it"},
+		&cli.BoolFlag{Name: "unpin", Usage: "Stop staying on the pinned build and update to the newest one"},
+		&cli.StringFlag{Name: "minecraft-version", Usage: "Minecraft version to update to, e.g. latest, latest-experimental or 1.21. Defaults to the installed version"},
+		&cli.BoolFlag{Name: "allow-version-change", Usage: "Allow the update to move the server to a different Minecraft version"},
 	},
 	Before: func(c *cli.Context) error {
 		log.Println("Updating the server...")
-		return nil
-	},
-	After: func(c *cli.Context) error {
-		log.Println("Update complete!")
+		// Load the config of the installed server
+		config := cfg.NewConfig()
+		_ = config.Load(utils.GetServerFolder(".kami.json", c))
+		c.Context = context.WithValue(c.Context, "config", config)
 		return nil
 	},
 	Action: func(c *cli.Context) error {
-		log.Println("TODO: Update the server")
+		config := c.Context.Value("config").(*cfg.Config)
+		updated, err := updateServer(c, config)
+		if err != nil {
+			return err
+		}
+		// Only save once we know it worked, a failed update shouldn't leave the config pointing at a build we don't have
+		err = config.Save(utils.GetServerFolder(".kami.json", c))
+		if err != nil {
+			return err
+		}
+		if updated {
+			log.Println("Update complete!")
+		}
 		return nil
 	},
 }
@@ -29,3 +54,123 @@ var updateCmd = &cli.Command{
 func init() {
 	rootCmd.Commands = append(rootCmd.Commands, updateCmd)
 }
+
+// updateServer does the update, returning whether a new build was installed
+func updateServer(c *cli.Context, config *cfg.Config) (bool, error) {
+	currentVersion := config.GetMinecraftVersion()
+	currentBuild := config.GetPaperBuild()
+	if currentVersion == "" || currentBuild == "" {
+		return false, fmt.Errorf("no installed server found in %s, run setup first", utils.GetServerFolder("", c))
+	}
+	serverSoftware, err := provider.Get(config.GetSoftware())
+	if err != nil {
+		return false, err
+	}
+	// Figure out which version we're updating to
+	targetVersion := currentVersion
+	if c.IsSet("minecraft-version") {
+		targetVersion, err = provider.ResolveVersion(c.Context, serverSoftware, c.String("minecraft-version"))
+		if err != nil {
+			return false, err
+		}
+	}
+	// Moving between Minecraft versions can break worlds and plugins, so only do it when asked to
+	if targetVersion != currentVersion && !c.Bool("allow-version-change") {
+		return false, fmt.Errorf("refusing to update from Minecraft %s to %s, pass --allow-version-change to do this", currentVersion, targetVersion)
+	}
+	if c.IsSet("channel") {
+		if _, err := provider.ChannelPolicyFor(serverSoftware, c.String("channel")); err != nil {
+			return false, err
+		}
+		config.SetChannel(c.String("channel"))
+	}
+	policy, err := provider.ChannelPolicyFor(serverSoftware, config.GetChannel())
+	if err != nil {
+		return false, err
+	}
+	if c.Bool("allow-experimental-builds") {
+		policy = provider.ChannelExperimental
+	}
+	if c.Bool("unpin") {
+		config.SetPinnedBuild("")
+	}
+	log.Printf("Currently installed: %s %s, build %s\n", serverSoftware.Name(), currentVersion, currentBuild)
+	var build *provider.Build
+	if c.IsSet("build") {
+		// Make sure the build exists before we touch anything
+		build, err = provider.FindBuild(c.Context, serverSoftware, targetVersion, c.String("build"))
+		if err != nil {
+			return false, explainVersionError(c.Context, serverSoftware, targetVersion, err)
+		}
+		config.SetPinnedBuild(build.ID)
+		if targetVersion == currentVersion && build.ID == currentBuild {
+			log.Printf("Build %s is already installed, staying on it\n", build.ID)
+			return false, nil
+		}
+	} else if config.GetPinnedBuild() != "" {
+		log.Printf("The server is pinned to build %s, use --build to pick another or --unpin to update to the newest\n", config.GetPinnedBuild())
+		return false, nil
+	} else {
+		build, err = provider.LatestBuild(c.Context, serverSoftware, targetVersion, policy)
+		if err != nil {
+			return false, explainVersionError(c.Context, serverSoftware, targetVersion, err)
+		}
+	}
+	if targetVersion == currentVersion && !c.IsSet("build") {
+		// The installed build could be newer if it was an experimental build and we're only allowing default ones now
+		newer, err := provider.IsNewer(c.Context, serverSoftware, targetVersion, currentBuild, build.ID)
+		if err != nil {
+			return false, err
+		}
+		if !newer {
+			log.Printf("%s is already up to date\n", serverSoftware.Name())
+			return false, nil
+		}
+	}
+	// Show what they're about to take. Across Minecraft versions this would be every build of the new one, so skip it
+	if targetVersion == currentVersion {
+		builds, err := provider.Changelog(c.Context, serverSoftware, targetVersion, currentBuild, build.ID)
+		if err != nil {
+			log.Printf("Couldn't get the changelog: %s\n", err)
+		} else if len(builds) > 0 {
+			log.Printf("Changes since build %s:\n", currentBuild)
+			writeChangelog(os.Stdout, builds)
+		}
+	}
+	// A new Minecraft version might need a newer Java, sort that out before the old jar goes anywhere
+	var jdk *lock.Artifact
+	if targetVersion != currentVersion {
+		requiredJavaVersion, err := provider.RequiredJava(c.Context, serverSoftware, targetVersion)
+		if err != nil {
+			return false, explainVersionError(c.Context, serverSoftware, targetVersion, err)
+		}
+		javaPath := config.GetJavaPath()
+		jdk, err = ensureJava(c, requiredJavaVersion, nil)
+		if err != nil {
+			return false, err
+		}
+		// Installers write their own run script when the build goes in, ours needs pointing at the new java
+		if _, ok := serverSoftware.(provider.Installer); !ok && config.GetJavaPath() != javaPath {
+			if _, err := writeStartScript(c, serverSoftware); err != nil {
+				return false, err
+			}
+		}
+	}
+	// Keep the current jar around so we can roll back to it
+	err = archiveInstalled(c, config)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Downloading %s build %s for Minecraft %s...\n", serverSoftware.Name(), build.ID, targetVersion)
+	download, err := installBuild(c, serverSoftware, targetVersion, build.ID)
+	if err != nil {
+		return false, err
+	}
+	recordInstall(config, serverSoftware, targetVersion, build.ID, download)
+	err = lockInstall(c, serverSoftware, targetVersion, build.ID, download, jdk)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Updated from Minecraft %s (build %s) to Minecraft %s (build %s)\n", currentVersion, currentBuild, targetVersion, build.ID)
+	return true, nil
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/cfg"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"github.com/urfave/cli/v2"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var versionsCmd = &cli.Command{
+	Name:        "versions",
+	Description: "List the Minecraft versions the server software has, or the builds of one of them",
+	Usage:       "List available versions, or the builds of a version",
+	ArgsUsage:   "[version]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "software", Usage: "Server software to list (" + strings.Join(provider.Names(), ", ") + "). Defaults to the installed software"},
+		&cli.StringFlag{Name: "format", Usage: "Output format (table, json, plain)", Value: "table"},
+		&cli.StringFlag{Name: "channel", Usage: "Only list builds on this channel (" + strings.Join(provider.ChannelPolicies, ", ") + ")"},
+		&cli.TimestampFlag{Name: "since", Usage: "Only list builds made on or after this date, e.g. 2024-06-01", Layout: "2006-01-02"},
+	},
+	Before: func(c *cli.Context) error {
+		config := cfg.NewConfig()
+		_ = config.Load(utils.GetServerFolder(".kami.json", c))
+		c.Context = context.WithValue(c.Context, "config", config)
+		return nil
+	},
+	Action: func(c *cli.Context) error {
+		config := c.Context.Value("config").(*cfg.Config)
+		format := c.String("format")
+		if format != "table" && format != "json" && format != "plain" {
+			return fmt.Errorf("unknown format %s, it has to be table, json or plain", format)
+		}
+		software := config.GetSoftware()
+		if c.IsSet("software") {
+			software = c.String("software")
+		}
+		serverSoftware, err := provider.Get(software)
+		if err != nil {
+			return err
+		}
+		if c.NArg() == 0 {
+			if c.IsSet("channel") || c.IsSet("since") {
+				return fmt.Errorf("--channel and --since filter builds, pass a version to list its builds")
+			}
+			versions, err := serverSoftware.Versions(c.Context)
+			if err != nil {
+				return err
+			}
+			return writeVersions(os.Stdout, format, versions)
+		}
+		version := c.Args().First()
+		builds, err := serverSoftware.Builds(c.Context, version)
+		if err != nil {
+			return explainVersionError(c.Context, serverSoftware, version, err)
+		}
+		if c.IsSet("channel") {
+			channel, err := provider.ChannelPolicyFor(serverSoftware, c.String("channel"))
+			if err != nil {
+				return err
+			}
+			builds = filterBuilds(builds, func(build provider.Build) bool {
+				// As a filter, experimental means only the experimental builds rather than everything
+				if channel == provider.ChannelExperimental {
+					return !build.Stable
+				}
+				return channel.Allows(build)
+			})
+		}
+		if since := c.Timestamp("since"); since != nil {
+			builds = filterBuilds(builds, func(build provider.Build) bool {
+				return !build.Time.Before(*since)
+			})
+		}
+		return writeBuilds(os.Stdout, format, builds)
+	},
+}
+
+func init() {
+	rootCmd.Commands = append(rootCmd.Commands, versionsCmd)
+}
+
+func filterBuilds(builds []provider.Build, keep func(provider.Build) bool) []provider.Build {
+	var filtered []provider.Build
+	for _, build := range builds {
+		if keep(build) {
+			filtered = append(filtered, build)
+		}
+	}
+	return filtered
+}
+
+func writeVersions(w io.Writer, format string, versions []string) error {
+	switch format {
+	case "json":
+		if versions == nil {
+			versions = []string{}
+		}
+		return writeJSON(w, versions)
+	case "plain":
+		for _, version := range versions {
+			fmt.Fprintln(w, version)
+		}
+		return nil
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "VERSION\tTYPE")
+	for _, version := range versions {
+		versionType := "release"
+		if strings.Contains(version, "-") {
+			versionType = "pre-release"
+		}
+		fmt.Fprintf(table, "%s\t%s\n", version, versionType)
+	}
+	return table.Flush()
+}
+
+type buildOutput struct {
+	Build    string            `json:"build"`
+	Channel  string            `json:"channel"`
+	Promoted bool              `json:"promoted"`
+	Time     *time.Time        `json:"time"`
+	Changes  []changelogChange `json:"changes"`
+}
+
+func writeBuilds(w io.Writer, format string, builds []provider.Build) error {
+	switch format {
+	case "json":
+		output := make([]buildOutput, 0, len(builds))
+		for _, build := range builds {
+			buildTime := &build.Time
+			if build.Time.IsZero() {
+				buildTime = nil
+			}
+			output = append(output, buildOutput{Build: build.ID, Channel: buildChannel(build), Promoted: build.Promoted, Time: buildTime, Changes: changelogChanges(build.Changes)})
+		}
+		return writeJSON(w, output)
+	case "plain":
+		for _, build := range builds {
+			fmt.Fprintln(w, build.ID)
+		}
+		return nil
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "BUILD\tCHANNEL\tPROMOTED\tTIME\tCHANGES")
+	for _, build := range builds {
+		promoted := ""
+		if build.Promoted {
+			promoted = "yes"
+		}
+		buildTime := ""
+		if !build.Time.IsZero() {
+			buildTime = build.Time.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", build.ID, buildChannel(build), promoted, buildTime, shortChangelog(build.Changes))
+	}
+	return table.Flush()
+}
+
+// buildChannel is the channel the API gave us, or what we make of the build if it didn't give us one
+func buildChannel(build provider.Build) string {
+	if build.Channel != "" {
+		return build.Channel
+	}
+	if build.Stable {
+		return "default"
+	}
+	return "experimental"
+}
+
+// shortChangelog squashes the changes down to fit on one line of the table
+func shortChangelog(changes []provider.Change) string {
+	if len(changes) == 0 {
+		return ""
+	}
+	summary := changes[0].Summary
+	if len(summary) > 60 {
+		summary = summary[:57] + "..."
+	}
+	if len(changes) > 1 {
+		summary += fmt.Sprintf(" (+%d more)", len(changes)-1)
+	}
+	return summary
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,255 @@
+package download
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This is the downloader every file we fetch goes through. It retries with backoff, resumes partial downloads with
+// HTTP ranges, checks the hash and only moves the file into place once it's complete and correct
+
+var Version = "dev"
+var Commit = "none"
+
+// Timeout is how long a single attempt at a download can take, 0 means it can take as long as it needs
+var Timeout time.Duration
+
+type Downloader struct {
+	Client *http.Client
+	// How many times to retry after the first attempt fails
+	Retries   int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout is how long each attempt can take, 0 means no limit
+	Timeout time.Duration
+	// Progress makes the progress reporter for a download, nil means no progress is shown
+	Progress func(description string) Progress
+}
+
+type Request struct {
+	URL         string
+	Dest        string
+	Description string
+	// Algorithm and Checksum are what the file is checked against, leave them empty to skip the check
+	Algorithm string
+	Checksum  string
+	Header    http.Header
+}
+
+func New() *Downloader {
+	return &Downloader{
+		Client:    &http.Client{},
+		Retries:   5,
+		BaseDelay: time.Second,
+		MaxDelay:  30 * time.Second,
+		Timeout:   Timeout,
+		Progress:  NewProgressBar,
+	}
+}
+
+// StatusError is returned when the server answers with anything other than a 2xx
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error downloading %s: %s", e.URL, e.Status)
+}
+
+// retryable is for errors where trying again might help
+type retryable struct {
+	err error
+}
+
+func (r *retryable) Error() string {
+	return r.err.Error()
+}
+
+func (r *retryable) Unwrap() error {
+	return r.err
+}
+
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+}
+
+// Download fetches the file to req.Dest. The data goes into req.Dest + ".part" first, which is kept between attempts
+// so they can pick up where the last one left off. If ctx is cancelled the partial file is removed
+func (d *Downloader) Download(ctx context.Context, req Request) error {
+	partPath := req.Dest + ".part"
+	err := d.download(ctx, req, partPath)
+	if err != nil && ctx.Err() != nil {
+		_ = os.Remove(partPath)
+		return ctx.Err()
+	}
+	return err
+}
+
+func (d *Downloader) download(ctx context.Context, req Request, partPath string) error {
+	var err error
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		if attempt > 0 {
+			delay := d.backoff(attempt)
+			log.Printf("Download failed (%s), retrying in %s...\n", err, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err = d.attempt(ctx, req, partPath)
+		if err == nil {
+			return os.Rename(partPath, req.Dest)
+		}
+		var retry *retryable
+		if !errors.As(err, &retry) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (d *Downloader) backoff(attempt int) time.Duration {
+	delay := d.BaseDelay << (attempt - 1)
+	if delay > d.MaxDelay || delay <= 0 {
+		return d.MaxDelay
+	}
+	return delay
+}
+
+func (d *Downloader) attempt(ctx context.Context, req Request, partPath string) error {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", req.URL, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range req.Header {
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+	if httpReq.Header.Get("User-Agent") == "" {
+		httpReq.Header.Set("User-Agent", "Kami Chan Server Installer"+"/"+Version+"/"+Commit)
+	}
+	if offset > 0 {
+		httpReq.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := d.Client.Do(httpReq)
+	if err != nil {
+		return &retryable{err}
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(offset, 10)+"-"):
+		// Carry on from where we left off
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// Whatever we have doesn't line up with the file anymore, start over
+		_ = os.Remove(partPath)
+		return &retryable{&StatusError{URL: req.URL, StatusCode: resp.StatusCode, Status: resp.Status}}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		// The server ignored the range (or we didn't send one), so we're getting the whole file
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
+		statusErr := &StatusError{URL: req.URL, StatusCode: resp.StatusCode, Status: resp.Status}
+		// Server errors and rate limits are worth waiting out, anything else won't change
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+			return &retryable{statusErr}
+		}
+		return statusErr
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var writer io.Writer = out
+	if d.Progress != nil {
+		progress := d.Progress(req.Description)
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+		progress.Start(total, offset)
+		defer progress.Finish()
+		writer = io.MultiWriter(out, progress)
+	}
+	if _, err := io.Copy(writer, resp.Body); err != nil {
+		return &retryable{err}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	err = verify(req, partPath)
+	if err != nil && offset > 0 {
+		// The bytes from the earlier attempt might be what's wrong, so it's worth one go from scratch
+		return &retryable{err}
+	}
+	return err
+}
+
+// verify checks the finished file's hash. If it's wrong the partial file is thrown away so nothing builds on it
+func verify(req Request, partPath string) error {
+	if req.Checksum == "" {
+		return nil
+	}
+	hash, err := NewHash(req.Algorithm)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(hash, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	fileHash := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(fileHash, req.Checksum) {
+		_ = os.Remove(partPath)
+		return fmt.Errorf("%s hash of %s does not match, expected %s but got %s", req.Algorithm, req.URL, req.Checksum, fileHash)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package download
+
+import (
+	"github.com/schollz/progressbar/v3"
+)
+
+// Progress is told how a download is going. Start is called at the beginning of every attempt
+type Progress interface {
+	// Start gets the total size (-1 if we don't know it) and how much we already have from an earlier attempt
+	Start(total, current int64)
+	Write(p []byte) (int, error)
+	Finish()
+}
+
+type progressBar struct {
+	description string
+	bar         *progressbar.ProgressBar
+}
+
+// NewProgressBar is the default progress reporter, it draws a progress bar in the terminal
+func NewProgressBar(description string) Progress {
+	return &progressBar{description: description}
+}
+
+func (p *progressBar) Start(total, current int64) {
+	p.bar = progressbar.DefaultBytes(total, p.description)
+	if current > 0 {
+		_ = p.bar.Set64(current)
+	}
+}
+
+func (p *progressBar) Write(b []byte) (int, error) {
+	return p.bar.Write(b)
+}
+
+func (p *progressBar) Finish() {
+	_ = p.bar.Finish()
+}
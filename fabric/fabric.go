@@ -0,0 +1,131 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"net/http"
+)
+
+// This will handle all of our API calls to the Fabric meta API
+
+var Version = "dev"
+var Commit = "none"
+
+const baseURL = "https://meta.fabricmc.net/v2"
+
+type FabricAPI struct {
+	client *http.Client
+}
+
+// NewFabricAPI makes its requests with client, nil means apiclient.New()
+func NewFabricAPI(client *http.Client) *FabricAPI {
+	if client == nil {
+		client = apiclient.New()
+	}
+	return &FabricAPI{
+		client: client,
+	}
+}
+
+func AddHeaders(req *http.Request) {
+	req.Header.Add("User-Agent", "Kami Chan Server Installer"+"/"+Version+"/"+Commit)
+}
+
+func (f *FabricAPI) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	AddHeaders(req)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := apierror.CheckResponse(resp, "Fabric meta"); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type GameVersion struct {
+	Version string `json:"version"`
+	Stable  bool   `json:"stable"`
+}
+
+// GetGameVersions returns every Minecraft version Fabric supports, newest first
+func (f *FabricAPI) GetGameVersions(ctx context.Context) ([]GameVersion, error) {
+	var gameVersions []GameVersion
+	if err := f.get(ctx, baseURL+"/versions/game", &gameVersions); err != nil {
+		return nil, err
+	}
+	return gameVersions, nil
+}
+
+type LoaderVersion struct {
+	Separator string `json:"separator"`
+	Build     int    `json:"build"`
+	Maven     string `json:"maven"`
+	Version   string `json:"version"`
+	Stable    bool   `json:"stable"`
+}
+
+type GameLoaderVersion struct {
+	Loader       LoaderVersion `json:"loader"`
+	Intermediary struct {
+		Maven   string `json:"maven"`
+		Version string `json:"version"`
+		Stable  bool   `json:"stable"`
+	} `json:"intermediary"`
+}
+
+// GetLoaderVersions returns the loader versions that work with the Minecraft version, newest first
+func (f *FabricAPI) GetLoaderVersions(ctx context.Context, gameVersion string) ([]GameLoaderVersion, error) {
+	var loaderVersions []GameLoaderVersion
+	if err := f.get(ctx, baseURL+"/versions/loader/"+gameVersion, &loaderVersions); err != nil {
+		return nil, apierror.VersionError(err, "fabric", gameVersion)
+	}
+	if len(loaderVersions) == 0 {
+		return nil, &apierror.VersionNotFoundError{Project: "fabric", Version: gameVersion}
+	}
+	return loaderVersions, nil
+}
+
+type InstallerVersion struct {
+	URL     string `json:"url"`
+	Maven   string `json:"maven"`
+	Version string `json:"version"`
+	Stable  bool   `json:"stable"`
+}
+
+// GetInstallerVersions returns every installer version, newest first
+func (f *FabricAPI) GetInstallerVersions(ctx context.Context) ([]InstallerVersion, error) {
+	var installerVersions []InstallerVersion
+	if err := f.get(ctx, baseURL+"/versions/installer", &installerVersions); err != nil {
+		return nil, err
+	}
+	return installerVersions, nil
+}
+
+// GetLatestInstallerVersion returns the newest stable installer
+func (f *FabricAPI) GetLatestInstallerVersion(ctx context.Context) (string, error) {
+	installerVersions, err := f.GetInstallerVersions(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, installerVersion := range installerVersions {
+		if installerVersion.Stable {
+			return installerVersion.Version, nil
+		}
+	}
+	return "", fmt.Errorf("no stable fabric installer found")
+}
+
+// GetServerJarURL is the URL of the server launcher jar for the given versions
+func (f *FabricAPI) GetServerJarURL(gameVersion, loaderVersion, installerVersion string) string {
+	return baseURL + "/versions/loader/" + gameVersion + "/" + loaderVersion + "/" + installerVersion + "/server/jar"
+}
@@ -0,0 +1,157 @@
+package forge
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// This will handle the Maven repositories of Forge and NeoForge. Both only ship installers for the server
+
+var Version = "dev"
+var Commit = "none"
+
+const forgeMavenURL = "https://maven.minecraftforge.net/net/minecraftforge/forge"
+const forgePromotionsURL = "https://files.minecraftforge.net/net/minecraftforge/forge/promotions_slim.json"
+const neoForgeMavenURL = "https://maven.neoforged.net/releases/net/neoforged/neoforge"
+const neoForgeVersionsURL = "https://maven.neoforged.net/api/maven/versions/releases/net/neoforged/neoforge"
+
+type ForgeAPI struct {
+	client *http.Client
+}
+
+// NewForgeAPI makes its requests with client, nil means apiclient.New()
+func NewForgeAPI(client *http.Client) *ForgeAPI {
+	if client == nil {
+		client = apiclient.New()
+	}
+	return &ForgeAPI{
+		client: client,
+	}
+}
+
+func AddHeaders(req *http.Request) {
+	req.Header.Add("User-Agent", "Kami Chan Server Installer"+"/"+Version+"/"+Commit)
+}
+
+func (f *ForgeAPI) get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	AddHeaders(req)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := apierror.CheckResponse(resp, "the Maven repository"); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+type mavenMetadata struct {
+	Versioning struct {
+		Versions []string `xml:"versions>version"`
+	} `xml:"versioning"`
+}
+
+// GetForgeVersions returns every Forge version in the Maven, these look like 1.20.1-47.3.0
+func (f *ForgeAPI) GetForgeVersions(ctx context.Context) ([]string, error) {
+	body, err := f.get(ctx, forgeMavenURL+"/maven-metadata.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var metadata mavenMetadata
+	if err := xml.NewDecoder(body).Decode(&metadata); err != nil {
+		return nil, err
+	}
+	return metadata.Versioning.Versions, nil
+}
+
+type PromotionsResponse struct {
+	Homepage string            `json:"homepage"`
+	Promos   map[string]string `json:"promos"`
+}
+
+// GetForgePromotions returns the recommended and latest Forge builds, keyed like 1.20.1-recommended
+func (f *ForgeAPI) GetForgePromotions(ctx context.Context) (*PromotionsResponse, error) {
+	body, err := f.get(ctx, forgePromotionsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var promotions PromotionsResponse
+	if err := json.NewDecoder(body).Decode(&promotions); err != nil {
+		return nil, err
+	}
+	return &promotions, nil
+}
+
+func (f *ForgeAPI) GetForgeInstallerURL(minecraftVersion, forgeVersion string) string {
+	fullVersion := minecraftVersion + "-" + forgeVersion
+	return forgeMavenURL + "/" + fullVersion + "/forge-" + fullVersion + "-installer.jar"
+}
+
+type NeoForgeVersionsResponse struct {
+	IsSnapshot bool     `json:"isSnapshot"`
+	Versions   []string `json:"versions"`
+}
+
+// GetNeoForgeVersions returns every NeoForge version, oldest first. These look like 21.1.65
+func (f *ForgeAPI) GetNeoForgeVersions(ctx context.Context) ([]string, error) {
+	body, err := f.get(ctx, neoForgeVersionsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var versions NeoForgeVersionsResponse
+	if err := json.NewDecoder(body).Decode(&versions); err != nil {
+		return nil, err
+	}
+	return versions.Versions, nil
+}
+
+func (f *ForgeAPI) GetNeoForgeInstallerURL(neoForgeVersion string) string {
+	return neoForgeMavenURL + "/" + neoForgeVersion + "/neoforge-" + neoForgeVersion + "-installer.jar"
+}
+
+// GetSha1 grabs the .sha1 file Maven keeps next to every artifact
+func (f *ForgeAPI) GetSha1(ctx context.Context, artifactURL string) (string, error) {
+	body, err := f.get(ctx, artifactURL+".sha1")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	sha1, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	// Some of these have the file name after the hash
+	fields := strings.Fields(string(sha1))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty sha1 for %s", artifactURL)
+	}
+	return fields[0], nil
+}
+
+// NeoForgeToMinecraft turns a NeoForge version into the Minecraft version it's for, 21.1.65 is for 1.21.1
+func NeoForgeToMinecraft(neoForgeVersion string) string {
+	split := strings.Split(neoForgeVersion, ".")
+	if len(split) < 2 {
+		return ""
+	}
+	if split[1] == "0" {
+		return "1." + split[0]
+	}
+	return "1." + split[0] + "." + split[1]
+}
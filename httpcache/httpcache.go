@@ -0,0 +1,195 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/cache"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// This caches API responses on disk so repeated runs don't keep asking for the same thing. A cached response is used
+// as is for a little while, after that we ask the server if it changed with ETag/If-Modified-Since, which is cheap and
+// doesn't count towards GitHub's rate limit
+
+// Only metadata is worth caching, anything bigger than this is passed straight through
+const maxBodySize = 8 * 1024 * 1024
+
+type Transport struct {
+	// Transport makes the actual requests, nil means http.DefaultTransport
+	Transport http.RoundTripper
+	// FreshFor is how long a cached response is used without checking with the server
+	FreshFor time.Duration
+}
+
+// Default is shared by all the API clients
+var Default = &Transport{FreshFor: time.Minute}
+
+type entry struct {
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cache.Disabled || req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.transport().RoundTrip(req)
+	}
+	path, err := entryPath(req.URL.String())
+	if err != nil {
+		return t.transport().RoundTrip(req)
+	}
+	cached, body := load(path)
+	if cached != nil && time.Since(cached.StoredAt) < t.FreshFor {
+		return cachedResponse(req, cached, body), nil
+	}
+
+	revalidate := req
+	if cached != nil {
+		revalidate = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			revalidate.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			revalidate.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	resp, err := t.transport().RoundTrip(revalidate)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		// Still good, so it's fresh again
+		for key, values := range resp.Header {
+			cached.Header[key] = values
+		}
+		cached.StoredAt = time.Now()
+		_ = save(path, cached, body)
+		return cachedResponse(req, cached, body), nil
+	}
+	if resp.StatusCode != http.StatusOK || !cacheable(resp) {
+		return resp, nil
+	}
+
+	// Read enough to know if it's small enough to cache
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(data) > maxBodySize {
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	_ = save(path, &entry{URL: req.URL.String(), Header: resp.Header, StoredAt: time.Now()}, data)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// cacheable checks the response can be revalidated and the server doesn't mind us keeping it
+func cacheable(resp *http.Response) bool {
+	if strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return false
+	}
+	return resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+func cachedResponse(req *http.Request, cached *entry, body []byte) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cached.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func entryPath(url string) (string, error) {
+	dir, err := cache.GetDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "http", hex.EncodeToString(sum[:])), nil
+}
+
+// load reads a cached response, it returns nil if there isn't one or it can't be read
+func load(path string) (*entry, []byte) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	// The first line is the entry, the rest is the body
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, nil
+	}
+	var cached entry
+	if err := json.Unmarshal(line, &cached); err != nil || cached.Header == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil
+	}
+	return &cached, body
+}
+
+func save(path string, cached *entry, body []byte) error {
+	line, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry.*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(append(line, '\n'), body...))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Clear removes every cached response
+func Clear() error {
+	dir, err := cache.GetDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(dir, "http"))
+}
@@ -0,0 +1,124 @@
+package lock
+
+import (
+	"github.com/goccy/go-json"
+	"os"
+)
+
+// This handles kami.lock, which records exactly what's installed so another server can be set up byte for byte the same
+// with setup --frozen
+
+const FileName = "kami.lock"
+
+// JDKFileName is kept next to a portable JDK once it's extracted, it has the JDK's artifact so any server sharing the
+// JDK can lock it without downloading it again
+const JDKFileName = "jdk.lock"
+
+// Names of the artifacts that aren't files from a modpack
+const (
+	Server = "server"
+	JDK    = "jdk"
+)
+
+type Artifact struct {
+	// server, jdk, or the path of the file for anything a modpack installed
+	Name string `json:"name"`
+	// Where the file lives, relative to the server folder. The JDK is just the installer's file name
+	Path string `json:"path"`
+	// Where the file was downloaded from. Files that came out of a modpack's zip don't have one
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+type Lockfile struct {
+	Software         string     `json:"software"`
+	MinecraftVersion string     `json:"minecraft_version"`
+	Build            string     `json:"build"`
+	Artifacts        []Artifact `json:"artifacts"`
+}
+
+// Load reads the lockfile at path
+func Load(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lockfile Lockfile
+	if err := json.Unmarshal(data, &lockfile); err != nil {
+		return nil, err
+	}
+	return &lockfile, nil
+}
+
+// LoadOrNew reads the lockfile at path, or starts a new one if there isn't one yet
+func LoadOrNew(path string) (*Lockfile, error) {
+	lockfile, err := Load(path)
+	if os.IsNotExist(err) {
+		return &Lockfile{}, nil
+	}
+	return lockfile, err
+}
+
+func (l *Lockfile) Save(path string) error {
+	return save(path, l)
+}
+
+// LoadArtifact reads an artifact saved on its own, like the one in JDKFileName
+func LoadArtifact(path string) (*Artifact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var artifact Artifact
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+// SaveArtifact saves the artifact on its own at path
+func SaveArtifact(path string, artifact Artifact) error {
+	return save(path, artifact)
+}
+
+func save(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write it somewhere else first so we never leave half a lockfile behind
+	err = os.WriteFile(path+".tmp", append(data, '\n'), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Get returns the artifact with the name, or nil if there isn't one
+func (l *Lockfile) Get(name string) *Artifact {
+	for i := range l.Artifacts {
+		if l.Artifacts[i].Name == name {
+			return &l.Artifacts[i]
+		}
+	}
+	return nil
+}
+
+// Set adds the artifact, replacing any artifact with the same name
+func (l *Lockfile) Set(artifact Artifact) {
+	if existing := l.Get(artifact.Name); existing != nil {
+		*existing = artifact
+		return
+	}
+	l.Artifacts = append(l.Artifacts, artifact)
+}
+
+// Remove drops the artifact with the name, if there is one
+func (l *Lockfile) Remove(name string) {
+	for i := range l.Artifacts {
+		if l.Artifacts[i].Name == name {
+			l.Artifacts = append(l.Artifacts[:i], l.Artifacts[i+1:]...)
+			return
+		}
+	}
+}
@@ -2,52 +2,40 @@ package main
 
 import (
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/mja00/kami-chan-server-installer/cmd"
+	"github.com/mja00/kami-chan-server-installer/download"
+	"github.com/mja00/kami-chan-server-installer/fabric"
+	"github.com/mja00/kami-chan-server-installer/forge"
+	"github.com/mja00/kami-chan-server-installer/mojang"
 	"github.com/mja00/kami-chan-server-installer/paper"
+	"github.com/mja00/kami-chan-server-installer/purpur"
 	"github.com/mja00/kami-chan-server-installer/update"
-	"log"
+	"os"
 )
 
 var Version = "dev"
 var Commit = "none"
 
 func main() {
-	// Clear the terminal
-	fmt.Println("\033[H\033[2J")
+	// Clear the terminal, but only if it is one. Otherwise we'd mess up output that's being piped somewhere, like --format json
+	if stat, err := os.Stdout.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		fmt.Println("\033[H\033[2J")
+	}
 	paper.Version = Version
 	paper.Commit = Commit
+	fabric.Version = Version
+	fabric.Commit = Commit
+	forge.Version = Version
+	forge.Commit = Commit
+	mojang.Version = Version
+	mojang.Commit = Commit
+	purpur.Version = Version
+	purpur.Commit = Commit
 	cmd.Version = Version
 	cmd.Commit = Commit
+	download.Version = Version
+	download.Commit = Commit
 	update.Version = Version
 	update.Commit = Commit
-	// Check for updates
-	updateAvailable, err := update.CheckForUpdates()
-	if err != nil {
-		log.Println("Error checking for updates:", err)
-	}
-	if updateAvailable {
-		color.Set(color.FgGreen)
-		log.Println("An update is available!")
-		url := update.GetUpdateURL()
-		if url == "" {
-			log.Println("Error downloading update")
-		} else {
-			//log.Println("Downloading update from:", url)
-			//downloadErr := update.DownloadUpdate(url)
-			//if downloadErr != nil {
-			//	log.Println("Error downloading update:", downloadErr)
-			//}
-			//installErr := update.InstallUpdate()
-			//if installErr != nil {
-			//	log.Println("Error installing update:", installErr)
-			//}
-			//log.Println("Update complete!")
-			//os.Exit(0)
-			// For now just print the URL. We support downloading the update and installing it. Just it's a bit janky.
-			log.Println("Download the update from:", url)
-		}
-		color.Unset()
-	}
 	cmd.Run()
 }
@@ -0,0 +1,250 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A mirror is a copy of every response we need to set up a server, so it can be done without internet.
+// Each response is stored at <root>/<host>/<path>/content, e.g. the Paper project is at
+// api.papermc.io/v2/projects/paper/content. The extra content file is there because a URL can be both a file and the
+// folder for the URLs under it. Redirects are kept as a redirect file next to where the content would be, holding the
+// URL they point at.
+// A mirror can be used straight from a directory, or served by any static file server and used from its URL
+
+// Path is where the response for u is stored in a mirror, it's always slash separated
+func Path(u *url.URL) string {
+	name := "content"
+	if u.RawQuery != "" {
+		name += "_" + url.QueryEscape(u.RawQuery)
+	}
+	// Ports can't be in Windows file names
+	host := strings.ReplaceAll(u.Host, ":", "_")
+	return path.Join(host, path.Clean("/"+u.Path), name)
+}
+
+// RedirectPath is where the redirect for u is stored in a mirror, it's always slash separated
+func RedirectPath(u *url.URL) string {
+	return path.Join(path.Dir(Path(u)), "redirect")
+}
+
+// Recorder is a RoundTripper that saves every successful response into the mirror at Root as it's read
+type Recorder struct {
+	Root      string
+	Transport http.RoundTripper
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err == nil && (req.Method == http.MethodGet || req.Method == http.MethodHead) && isRedirect(resp) {
+		// Links like Corretto's latest ones get asked about without following them, so they're kept too
+		if err := r.recordRedirect(req, resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp, nil
+	}
+	// Partial responses would only be part of the file, so we only keep full ones
+	if err != nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	target := filepath.Join(r.Root, filepath.FromSlash(Path(req.URL)))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(target), ".content.*.tmp")
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &recordingBody{body: resp.Body, file: file, target: target}
+	return resp, nil
+}
+
+func (r *Recorder) recordRedirect(req *http.Request, resp *http.Response) error {
+	location, err := resp.Location()
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(r.Root, filepath.FromSlash(RedirectPath(req.URL)))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, []byte(location.String()), 0644)
+}
+
+func isRedirect(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return resp.Header.Get("Location") != ""
+	}
+	return false
+}
+
+// recordingBody copies everything read from the body into file, and moves it to target once the whole body is read
+type recordingBody struct {
+	body   io.ReadCloser
+	file   *os.File
+	target string
+	err    error
+	done   bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 && b.err == nil {
+		_, b.err = b.file.Write(p[:n])
+	}
+	if err == io.EOF && !b.done {
+		b.done = true
+		if closeErr := b.file.Close(); closeErr != nil && b.err == nil {
+			b.err = closeErr
+		}
+		if b.err == nil {
+			b.err = os.Rename(b.file.Name(), b.target)
+		}
+		if b.err != nil {
+			_ = os.Remove(b.file.Name())
+			return n, fmt.Errorf("error saving %s to the mirror: %w", b.target, b.err)
+		}
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	// JSON decoders stop at the end of the value without reading to EOF, so finish off what's left if it's only a bit
+	if !b.done {
+		_, _ = io.Copy(io.Discard, io.LimitReader(b, 64*1024))
+	}
+	if !b.done {
+		// We didn't get the whole thing, so don't keep any of it
+		b.done = true
+		b.file.Close()
+		_ = os.Remove(b.file.Name())
+	}
+	return b.body.Close()
+}
+
+// NewTransport returns a RoundTripper that answers every request from the mirror at location, which is either a
+// directory or the URL of a server hosting one
+func NewTransport(location string) (http.RoundTripper, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		base, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		return &urlTransport{base: base, transport: http.DefaultTransport}, nil
+	}
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("mirror %s is not a directory", location)
+	}
+	return &dirTransport{root: location}, nil
+}
+
+type dirTransport struct {
+	root string
+}
+
+func (t *dirTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return response(req, http.StatusMethodNotAllowed, io.NopCloser(strings.NewReader("")), 0), nil
+	}
+	file, err := os.Open(filepath.Join(t.root, filepath.FromSlash(Path(req.URL))))
+	if os.IsNotExist(err) {
+		if location, err := os.ReadFile(filepath.Join(t.root, filepath.FromSlash(RedirectPath(req.URL)))); err == nil {
+			return redirect(req, string(location)), nil
+		}
+		message := req.URL.String() + " is not in the mirror"
+		return response(req, http.StatusNotFound, io.NopCloser(strings.NewReader(message)), int64(len(message))), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if req.Method == http.MethodHead {
+		file.Close()
+		return response(req, http.StatusOK, io.NopCloser(strings.NewReader("")), info.Size()), nil
+	}
+	// We always send the whole file, anything asking for a range will see that and start from the beginning
+	return response(req, http.StatusOK, file, info.Size()), nil
+}
+
+func response(req *http.Request, status int, body io.ReadCloser, length int64) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+}
+
+func redirect(req *http.Request, location string) *http.Response {
+	resp := response(req, http.StatusFound, io.NopCloser(strings.NewReader("")), 0)
+	resp.Header.Set("Location", strings.TrimSpace(location))
+	return resp
+}
+
+type urlTransport struct {
+	base      *url.URL
+	transport http.RoundTripper
+}
+
+func (t *urlTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(t.mirrored(req, Path(req.URL)))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		return resp, err
+	}
+	// It might have been a redirect, those are only asked for when there's no content
+	redirectReq := t.mirrored(req, RedirectPath(req.URL))
+	redirectReq.Method = http.MethodGet
+	redirectResp, err := t.transport.RoundTrip(redirectReq)
+	if err != nil || redirectResp.StatusCode != http.StatusOK {
+		if err == nil {
+			redirectResp.Body.Close()
+		}
+		return resp, nil
+	}
+	defer redirectResp.Body.Close()
+	location, err := io.ReadAll(io.LimitReader(redirectResp.Body, 8*1024))
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return redirect(req, string(location)), nil
+}
+
+// mirrored is req, but asking the mirror for the file at mirrorPath
+func (t *urlTransport) mirrored(req *http.Request, mirrorPath string) *http.Request {
+	mirrored := req.Clone(req.Context())
+	// Path is set unescaped, so the %s in query file names get escaped on the way out
+	mirroredURL := *t.base
+	mirroredURL.Path = path.Join("/", t.base.Path, mirrorPath)
+	mirroredURL.RawPath = ""
+	mirroredURL.RawQuery = ""
+	mirrored.URL = &mirroredURL
+	mirrored.Host = ""
+	return mirrored
+}
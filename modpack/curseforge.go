@@ -0,0 +1,195 @@
+package modpack
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// This handles CurseForge server packs. They're zips with a manifest.json somewhere in them, and unlike Modrinth packs
+// they already have the mods inside their overrides folder, so it's mostly a case of copying that over the server
+
+type CurseForgeManifest struct {
+	Minecraft struct {
+		Version    string `json:"version"`
+		ModLoaders []struct {
+			// Looks like forge-47.2.0
+			ID      string `json:"id"`
+			Primary bool   `json:"primary"`
+		} `json:"modLoaders"`
+	} `json:"minecraft"`
+	ManifestType    string `json:"manifestType"`
+	ManifestVersion int    `json:"manifestVersion"`
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	Author          string `json:"author"`
+	Files           []struct {
+		ProjectID int  `json:"projectID"`
+		FileID    int  `json:"fileID"`
+		Required  bool `json:"required"`
+	} `json:"files"`
+	Overrides string `json:"overrides"`
+}
+
+type CurseForgePack struct {
+	Manifest CurseForgeManifest
+	path     string
+	// The folder inside the zip the manifest is in, server packs are often wrapped in a folder
+	root string
+}
+
+// CurseForge's loader names mapped to our provider names
+var curseForgeLoaders = map[string]string{
+	"forge":    "forge",
+	"neoforge": "neoforge",
+	"fabric":   "fabric",
+}
+
+func OpenCurseForgePack(zipPath string) (*CurseForgePack, error) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	// Find the manifest closest to the top of the zip
+	var manifestFile *zip.File
+	for _, file := range reader.File {
+		if path.Base(file.Name) != "manifest.json" {
+			continue
+		}
+		if manifestFile == nil || strings.Count(file.Name, "/") < strings.Count(manifestFile.Name, "/") {
+			manifestFile = file
+		}
+	}
+	if manifestFile == nil {
+		return nil, fmt.Errorf("%s is not a CurseForge modpack, it has no manifest.json", zipPath)
+	}
+	in, err := manifestFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	pack := &CurseForgePack{path: zipPath, root: path.Dir(manifestFile.Name)}
+	if err := json.NewDecoder(in).Decode(&pack.Manifest); err != nil {
+		return nil, err
+	}
+	if pack.Manifest.ManifestType != "minecraftModpack" {
+		return nil, fmt.Errorf("unsupported manifest type: %s", pack.Manifest.ManifestType)
+	}
+	if pack.Manifest.Overrides == "" {
+		pack.Manifest.Overrides = "overrides"
+	}
+	return pack, nil
+}
+
+func (p *CurseForgePack) Source() string {
+	return "curseforge"
+}
+
+func (p *CurseForgePack) Name() string {
+	return p.Manifest.Name
+}
+
+func (p *CurseForgePack) Version() string {
+	return p.Manifest.Version
+}
+
+func (p *CurseForgePack) MinecraftVersion() string {
+	return p.Manifest.Minecraft.Version
+}
+
+func (p *CurseForgePack) Loader() (string, string, error) {
+	loaders := p.Manifest.Minecraft.ModLoaders
+	if len(loaders) == 0 {
+		return "", "", fmt.Errorf("modpack doesn't say which mod loader it needs")
+	}
+	loader := loaders[0]
+	for _, modLoader := range loaders {
+		if modLoader.Primary {
+			loader = modLoader
+		}
+	}
+	name, loaderVersion, found := strings.Cut(loader.ID, "-")
+	software, ok := curseForgeLoaders[name]
+	if !found || !ok {
+		return "", "", fmt.Errorf("unsupported mod loader: %s", loader.ID)
+	}
+	return software, loaderVersion, nil
+}
+
+// Install extracts the pack somewhere temporary, then copies the overrides folder named in the manifest into the
+// server folder. Nothing else in the pack goes near the server
+func (p *CurseForgePack) Install(_ context.Context, serverDir string) ([]string, error) {
+	tempDir, err := os.MkdirTemp("", "kami-import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := utils.ExtractZip(p.path, tempDir); err != nil {
+		return nil, err
+	}
+	// The overrides folder comes from the manifest, so it could point anywhere
+	overridesDir, err := utils.SafeJoin(tempDir, path.Join(p.root, p.Manifest.Overrides))
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(overridesDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("the pack doesn't have the %s folder its manifest says it does", p.Manifest.Overrides)
+	}
+	var paths []string
+	err = filepath.WalkDir(overridesDir, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, err := filepath.Rel(overridesDir, filePath)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		target, err := utils.SafeJoin(serverDir, relative)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		// The temp folder is probably on another drive, so this has to be a copy rather than a rename
+		if err := utils.CopyFile(filePath, target); err != nil {
+			return err
+		}
+		paths = append(paths, relative)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Manifest.Files) > 0 && !hasMods(paths) {
+		log.Printf("Warning: the pack lists %d mods but doesn't include them. Use the server pack from CurseForge instead\n", len(p.Manifest.Files))
+	}
+	return paths, nil
+}
+
+// URL is always empty, server packs come with all their files
+func (p *CurseForgePack) URL(_ string) string {
+	return ""
+}
+
+func (p *CurseForgePack) Close() error {
+	return nil
+}
+
+func hasMods(paths []string) bool {
+	for _, filePath := range paths {
+		if strings.HasPrefix(filePath, "mods/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package modpack
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pack is a modpack we know how to set a server up from
+type Pack interface {
+	// Source is where the pack came from, e.g. modrinth
+	Source() string
+	Name() string
+	Version() string
+	MinecraftVersion() string
+	// Loader returns the provider name and loader version the pack needs
+	Loader() (string, string, error)
+	// Install puts the pack's files in the server folder and returns their paths relative to it
+	Install(ctx context.Context, serverDir string) ([]string, error)
+	// URL returns where an installed file was downloaded from, or an empty string if it came out of the pack itself
+	URL(path string) string
+	Close() error
+}
+
+// Open works out what kind of modpack the file is and opens it
+func Open(path string) (Pack, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mrpack":
+		return OpenModrinthPack(path)
+	case ".zip":
+		return OpenCurseForgePack(path)
+	}
+	return nil, fmt.Errorf("unsupported pack format: %s, it has to be a Modrinth .mrpack or a CurseForge .zip", filepath.Base(path))
+}
+
+// extractFolder copies everything inside folder in the zip into dest, returning the paths it wrote relative to dest
+func extractFolder(reader *zip.Reader, folder, dest string) ([]string, error) {
+	var paths []string
+	prefix := folder + "/"
+	for _, file := range reader.File {
+		if !strings.HasPrefix(file.Name, prefix) || file.FileInfo().IsDir() {
+			continue
+		}
+		relative := strings.TrimPrefix(file.Name, prefix)
+		target, err := utils.SafeJoin(dest, relative)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := extractFile(file, target); err != nil {
+			return nil, err
+		}
+		paths = append(paths, relative)
+	}
+	return paths, nil
+}
+
+func extractFile(file *zip.File, target string) error {
+	in, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// RemoveStaleFiles deletes the files a previous version of the pack installed that the new version doesn't have
+func RemoveStaleFiles(serverDir string, previous, current []string) error {
+	keep := map[string]bool{}
+	for _, path := range current {
+		keep[path] = true
+	}
+	for _, path := range previous {
+		if keep[path] {
+			continue
+		}
+		target, err := utils.SafeJoin(serverDir, path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
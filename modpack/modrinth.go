@@ -0,0 +1,217 @@
+package modpack
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/provider"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// This handles Modrinth's .mrpack format. It's a zip with a modrinth.index.json that lists the files to download,
+// plus overrides folders that get copied over the top of the server
+
+type ModrinthFile struct {
+	Path   string            `json:"path"`
+	Hashes map[string]string `json:"hashes"`
+	Env    *struct {
+		Client string `json:"client"`
+		Server string `json:"server"`
+	} `json:"env"`
+	Downloads []string `json:"downloads"`
+	FileSize  int64    `json:"fileSize"`
+}
+
+type ModrinthIndex struct {
+	FormatVersion int            `json:"formatVersion"`
+	Game          string         `json:"game"`
+	VersionID     string         `json:"versionId"`
+	Name          string         `json:"name"`
+	Summary       string         `json:"summary"`
+	Files         []ModrinthFile `json:"files"`
+	// minecraft plus the loader, e.g. fabric-loader, forge or neoforge
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+type ModrinthPack struct {
+	Index  ModrinthIndex
+	reader *zip.ReadCloser
+	// Path -> the URL it was downloaded from
+	urls map[string]string
+}
+
+// Modrinth's dependency names and our provider names for them. It's a list so Loader always looks at them in the
+// same order, map order would change from run to run
+var modrinthLoaders = []struct {
+	dependency string
+	software   string
+}{
+	{"fabric-loader", "fabric"},
+	{"forge", "forge"},
+	{"neoforge", "neoforge"},
+}
+
+func OpenModrinthPack(path string) (*ModrinthPack, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	pack := &ModrinthPack{reader: reader}
+	indexFile, err := reader.Open("modrinth.index.json")
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("%s is not a Modrinth modpack: %s", path, err)
+	}
+	defer indexFile.Close()
+	if err := json.NewDecoder(indexFile).Decode(&pack.Index); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if pack.Index.Game != "minecraft" {
+		reader.Close()
+		return nil, fmt.Errorf("modpack is for %s, not minecraft", pack.Index.Game)
+	}
+	return pack, nil
+}
+
+func (p *ModrinthPack) Source() string {
+	return "modrinth"
+}
+
+func (p *ModrinthPack) Name() string {
+	return p.Index.Name
+}
+
+func (p *ModrinthPack) Version() string {
+	return p.Index.VersionID
+}
+
+// Install downloads all the server files and then applies the overrides on top
+func (p *ModrinthPack) Install(ctx context.Context, serverDir string) ([]string, error) {
+	log.Printf("Downloading %d files...\n", len(p.ServerFiles()))
+	files, err := p.DownloadFiles(ctx, serverDir)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Applying overrides...")
+	overrides, err := p.ApplyOverrides(serverDir)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, overrides...), nil
+}
+
+func (p *ModrinthPack) URL(path string) string {
+	return p.urls[path]
+}
+
+func (p *ModrinthPack) Close() error {
+	return p.reader.Close()
+}
+
+func (p *ModrinthPack) MinecraftVersion() string {
+	return p.Index.Dependencies["minecraft"]
+}
+
+// Loader returns the provider name and loader version the pack needs
+func (p *ModrinthPack) Loader() (string, string, error) {
+	for _, loader := range modrinthLoaders {
+		if loaderVersion, ok := p.Index.Dependencies[loader.dependency]; ok {
+			return loader.software, loaderVersion, nil
+		}
+	}
+	// Anything left is a loader we don't support, e.g. quilt-loader
+	var unsupported []string
+	for dependency := range p.Index.Dependencies {
+		if dependency != "minecraft" {
+			unsupported = append(unsupported, dependency)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return "", "", fmt.Errorf("unsupported mod loader: %s", strings.Join(unsupported, ", "))
+	}
+	return "", "", fmt.Errorf("modpack doesn't say which mod loader it needs")
+}
+
+// ServerFiles are the files that should be on the server, client only mods get skipped
+func (p *ModrinthPack) ServerFiles() []ModrinthFile {
+	var files []ModrinthFile
+	for _, file := range p.Index.Files {
+		if file.Env != nil && file.Env.Server == "unsupported" {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// DownloadFiles downloads every server file into the server folder and returns their paths
+func (p *ModrinthPack) DownloadFiles(ctx context.Context, serverDir string) ([]string, error) {
+	var paths []string
+	for _, file := range p.ServerFiles() {
+		target, err := utils.SafeJoin(serverDir, file.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		// sha512 is the better hash, but sha1 is the only one the format requires
+		checksum := &provider.Checksum{Algorithm: "sha512", Value: file.Hashes["sha512"]}
+		if checksum.Value == "" {
+			checksum = &provider.Checksum{Algorithm: "sha1", Value: file.Hashes["sha1"]}
+		}
+		if checksum.Value == "" {
+			return nil, fmt.Errorf("%s has no hash to check it against", file.Path)
+		}
+		// Try each mirror until one works
+		var downloadErr error
+		for _, url := range file.Downloads {
+			downloadErr = provider.Fetch(ctx, &provider.Download{
+				URL:      url,
+				FileName: filepath.Base(file.Path),
+				Checksum: checksum,
+			}, target)
+			if downloadErr == nil {
+				if p.urls == nil {
+					p.urls = map[string]string{}
+				}
+				p.urls[file.Path] = url
+				break
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Error downloading %s from %s: %s\n", file.Path, url, downloadErr)
+		}
+		if len(file.Downloads) == 0 {
+			downloadErr = fmt.Errorf("%s has no downloads", file.Path)
+		}
+		if downloadErr != nil {
+			return nil, downloadErr
+		}
+		paths = append(paths, file.Path)
+	}
+	return paths, nil
+}
+
+// ApplyOverrides copies the overrides folder, then the server-overrides folder, into the server folder.
+// Returns the paths of all the files it wrote
+func (p *ModrinthPack) ApplyOverrides(serverDir string) ([]string, error) {
+	var paths []string
+	for _, folder := range []string{"overrides", "server-overrides"} {
+		written, err := extractFolder(&p.reader.Reader, folder, serverDir)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, written...)
+	}
+	return paths, nil
+}
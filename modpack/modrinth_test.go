@@ -0,0 +1,301 @@
+package modpack
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/hex"
+	"github.com/goccy/go-json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fileServer stands in for Modrinth's CDN, serving files by path and remembering which ones were asked for
+type fileServer struct {
+	*httptest.Server
+	files     map[string]string
+	mu        sync.Mutex
+	requested map[string]bool
+}
+
+func newFileServer(t *testing.T, files map[string]string) *fileServer {
+	t.Helper()
+	server := &fileServer{files: files, requested: map[string]bool{}}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		server.requested[r.URL.Path] = true
+		server.mu.Unlock()
+		content, ok := server.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fileServer) wasRequested(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requested[path]
+}
+
+func sha512Hex(content string) string {
+	sum := sha512.Sum512([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha1Hex(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// writePack writes an .mrpack with the index and the extra files (e.g. overrides) in it
+func writePack(t *testing.T, index ModrinthIndex, extra map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pack.mrpack")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	if index.Game == "" {
+		index.Game = "minecraft"
+	}
+	indexWriter, err := writer.Create("modrinth.index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(indexWriter).Encode(index); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range extra {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openPack(t *testing.T, index ModrinthIndex, extra map[string]string) *ModrinthPack {
+	t.Helper()
+	pack, err := OpenModrinthPack(writePack(t, index, extra))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pack.Close() })
+	return pack
+}
+
+func serverOnly(server string) *struct {
+	Client string `json:"client"`
+	Server string `json:"server"`
+} {
+	return &struct {
+		Client string `json:"client"`
+		Server string `json:"server"`
+	}{Client: "required", Server: server}
+}
+
+func TestDownloadFilesVerifiesHashes(t *testing.T) {
+	server := newFileServer(t, map[string]string{
+		"/good.jar":  "good mod",
+		"/bad.jar":   "tampered mod",
+		"/sha1.jar":  "old pack mod",
+		"/bad1.jar":  "tampered old pack mod",
+		"/other.jar": "other mod",
+	})
+	serverDir := t.TempDir()
+
+	pack := openPack(t, ModrinthIndex{Files: []ModrinthFile{
+		{Path: "mods/good.jar", Hashes: map[string]string{"sha512": sha512Hex("good mod")}, Downloads: []string{server.URL + "/good.jar"}},
+		// Only sha1, which is all the format requires
+		{Path: "mods/sha1.jar", Hashes: map[string]string{"sha1": sha1Hex("old pack mod")}, Downloads: []string{server.URL + "/sha1.jar"}},
+	}}, nil)
+	paths, err := pack.DownloadFiles(context.Background(), serverDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(paths, ",") != "mods/good.jar,mods/sha1.jar" {
+		t.Errorf("got paths %v", paths)
+	}
+	if content, _ := os.ReadFile(filepath.Join(serverDir, "mods", "good.jar")); string(content) != "good mod" {
+		t.Errorf("got %q for good.jar", content)
+	}
+	if pack.URL("mods/good.jar") != server.URL+"/good.jar" {
+		t.Errorf("got URL %q for good.jar", pack.URL("mods/good.jar"))
+	}
+
+	for name, file := range map[string]ModrinthFile{
+		"sha512": {Path: "mods/bad.jar", Hashes: map[string]string{"sha512": sha512Hex("mod"), "sha1": sha1Hex("tampered mod")}, Downloads: []string{server.URL + "/bad.jar"}},
+		"sha1":   {Path: "mods/bad1.jar", Hashes: map[string]string{"sha1": sha1Hex("old pack mod")}, Downloads: []string{server.URL + "/bad1.jar"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pack := openPack(t, ModrinthIndex{Files: []ModrinthFile{file}}, nil)
+			_, err := pack.DownloadFiles(context.Background(), serverDir)
+			if err == nil || !strings.Contains(err.Error(), "does not match") {
+				t.Fatalf("expected a hash mismatch, got %v", err)
+			}
+			// Nothing that failed the check should be left behind
+			if _, err := os.Stat(filepath.Join(serverDir, filepath.FromSlash(file.Path))); !os.IsNotExist(err) {
+				t.Errorf("%s was left in the server folder", file.Path)
+			}
+		})
+	}
+
+	t.Run("no hash", func(t *testing.T) {
+		pack := openPack(t, ModrinthIndex{Files: []ModrinthFile{
+			{Path: "mods/other.jar", Downloads: []string{server.URL + "/other.jar"}},
+		}}, nil)
+		if _, err := pack.DownloadFiles(context.Background(), serverDir); err == nil {
+			t.Fatal("expected a file without a hash to be refused")
+		}
+		if server.wasRequested("/other.jar") {
+			t.Error("a file without a hash was downloaded")
+		}
+	})
+}
+
+func TestDownloadFilesSkipsClientOnlyFiles(t *testing.T) {
+	server := newFileServer(t, map[string]string{
+		"/server.jar": "server mod",
+		"/client.jar": "client mod",
+	})
+	serverDir := t.TempDir()
+	pack := openPack(t, ModrinthIndex{Files: []ModrinthFile{
+		{Path: "mods/server.jar", Hashes: map[string]string{"sha512": sha512Hex("server mod")}, Env: serverOnly("required"), Downloads: []string{server.URL + "/server.jar"}},
+		{Path: "mods/client.jar", Hashes: map[string]string{"sha512": sha512Hex("client mod")}, Env: serverOnly("unsupported"), Downloads: []string{server.URL + "/client.jar"}},
+	}}, nil)
+	paths, err := pack.DownloadFiles(context.Background(), serverDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "mods/server.jar" {
+		t.Errorf("got paths %v", paths)
+	}
+	if server.wasRequested("/client.jar") {
+		t.Error("the client only mod was downloaded")
+	}
+	if _, err := os.Stat(filepath.Join(serverDir, "mods", "client.jar")); !os.IsNotExist(err) {
+		t.Error("the client only mod is in the server folder")
+	}
+}
+
+func TestApplyOverridesLayersServerOverrides(t *testing.T) {
+	serverDir := t.TempDir()
+	pack := openPack(t, ModrinthIndex{}, map[string]string{
+		"overrides/config/shared.toml":        "from overrides",
+		"overrides/config/client.toml":        "client settings",
+		"server-overrides/config/shared.toml": "from server-overrides",
+		"server-overrides/server.properties":  "motd=pack",
+		"client-overrides/options.txt":        "client only",
+	})
+	paths, err := pack.ApplyOverrides(serverDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"config/shared.toml": "from server-overrides",
+		"config/client.toml": "client settings",
+		"server.properties":  "motd=pack",
+	} {
+		content, err := os.ReadFile(filepath.Join(serverDir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		if string(content) != want {
+			t.Errorf("%s is %q, expected %q", path, content, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(serverDir, "options.txt")); !os.IsNotExist(err) {
+		t.Error("client-overrides were applied to the server")
+	}
+	if len(paths) != 4 {
+		t.Errorf("expected the 4 files written to be returned, got %v", paths)
+	}
+}
+
+func TestPathTraversalIsRejected(t *testing.T) {
+	server := newFileServer(t, map[string]string{"/evil.jar": "evil"})
+	parent := t.TempDir()
+	serverDir := filepath.Join(parent, "server")
+	if err := os.Mkdir(serverDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"../evil.jar", "mods/../../evil.jar", "/tmp/evil.jar"} {
+		t.Run("file "+path, func(t *testing.T) {
+			pack := openPack(t, ModrinthIndex{Files: []ModrinthFile{
+				{Path: path, Hashes: map[string]string{"sha512": sha512Hex("evil")}, Downloads: []string{server.URL + "/evil.jar"}},
+			}}, nil)
+			if _, err := pack.DownloadFiles(context.Background(), serverDir); err == nil || !strings.Contains(err.Error(), "refusing") {
+				t.Fatalf("expected %s to be refused, got %v", path, err)
+			}
+		})
+	}
+	if server.wasRequested("/evil.jar") {
+		t.Error("a file outside the server folder was downloaded")
+	}
+
+	t.Run("override", func(t *testing.T) {
+		pack := openPack(t, ModrinthIndex{}, map[string]string{"overrides/../../evil.txt": "evil"})
+		if _, err := pack.ApplyOverrides(serverDir); err == nil || !strings.Contains(err.Error(), "refusing") {
+			t.Fatalf("expected the override to be refused, got %v", err)
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join(parent, "evil.jar")); !os.IsNotExist(err) {
+		t.Error("evil.jar was written outside the server folder")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(parent), "evil.txt")); !os.IsNotExist(err) {
+		t.Error("evil.txt was written outside the server folder")
+	}
+}
+
+func TestLoaderIsStable(t *testing.T) {
+	for name, test := range map[string]struct {
+		dependencies map[string]string
+		software     string
+		version      string
+		err          string
+	}{
+		"fabric":      {dependencies: map[string]string{"minecraft": "1.20.4", "fabric-loader": "0.15.11"}, software: "fabric", version: "0.15.11"},
+		"with extras": {dependencies: map[string]string{"minecraft": "1.20.4", "quilt-loader": "0.26.0", "neoforge": "20.4.237"}, software: "neoforge", version: "20.4.237"},
+		"unsupported": {dependencies: map[string]string{"minecraft": "1.20.4", "quilt-loader": "0.26.0"}, err: "unsupported mod loader: quilt-loader"},
+		"missing":     {dependencies: map[string]string{"minecraft": "1.20.4"}, err: "doesn't say"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pack := &ModrinthPack{Index: ModrinthIndex{Dependencies: test.dependencies}}
+			// Map order is random, so ask a few times
+			for i := 0; i < 20; i++ {
+				software, version, err := pack.Loader()
+				if test.err != "" {
+					if err == nil || !strings.Contains(err.Error(), test.err) {
+						t.Fatalf("expected an error containing %q, got %v", test.err, err)
+					}
+					continue
+				}
+				if err != nil || software != test.software || version != test.version {
+					t.Fatalf("got %s %s %v, expected %s %s", software, version, err, test.software, test.version)
+				}
+			}
+		})
+	}
+}
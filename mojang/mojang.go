@@ -0,0 +1,105 @@
+package mojang
+
+import (
+	"context"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"net/http"
+	"time"
+)
+
+// This will handle reading Mojang's version manifest, which is where vanilla servers come from
+
+var Version = "dev"
+var Commit = "none"
+
+const manifestURL = "https://piston-meta.mojang.com/mc/game/version_manifest_v2.json"
+
+type MojangAPI struct {
+	client *http.Client
+}
+
+// NewMojangAPI makes its requests with client, nil means apiclient.New()
+func NewMojangAPI(client *http.Client) *MojangAPI {
+	if client == nil {
+		client = apiclient.New()
+	}
+	return &MojangAPI{
+		client: client,
+	}
+}
+
+func AddHeaders(req *http.Request) {
+	req.Header.Add("User-Agent", "Kami Chan Server Installer"+"/"+Version+"/"+Commit)
+}
+
+func (m *MojangAPI) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	AddHeaders(req)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := apierror.CheckResponse(resp, "Mojang"); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type ManifestVersion struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	URL         string    `json:"url"`
+	Time        time.Time `json:"time"`
+	ReleaseTime time.Time `json:"releaseTime"`
+	Sha1        string    `json:"sha1"`
+}
+
+type ManifestResponse struct {
+	Latest struct {
+		Release  string `json:"release"`
+		Snapshot string `json:"snapshot"`
+	} `json:"latest"`
+	// Newest versions come first
+	Versions []ManifestVersion `json:"versions"`
+}
+
+func (m *MojangAPI) GetManifest(ctx context.Context) (*ManifestResponse, error) {
+	var manifest ManifestResponse
+	if err := m.get(ctx, manifestURL, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+type VersionResponse struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	ReleaseTime time.Time `json:"releaseTime"`
+	Downloads   struct {
+		Server *struct {
+			Sha1 string `json:"sha1"`
+			Size int64  `json:"size"`
+			URL  string `json:"url"`
+		} `json:"server"`
+	} `json:"downloads"`
+	JavaVersion struct {
+		Component    string `json:"component"`
+		MajorVersion int    `json:"majorVersion"`
+	} `json:"javaVersion"`
+}
+
+// GetVersion grabs the per version JSON, the URL for it comes from the manifest
+func (m *MojangAPI) GetVersion(ctx context.Context, version ManifestVersion) (*VersionResponse, error) {
+	var versionResponse VersionResponse
+	if err := m.get(ctx, version.URL, &versionResponse); err != nil {
+		return nil, err
+	}
+	return &versionResponse, nil
+}
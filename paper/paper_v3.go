@@ -0,0 +1,182 @@
+package paper
+
+import (
+	"context"
+	"fmt"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// This is the client for Fill, the v3 Paper API
+
+const baseURLV3 = "https://fill.papermc.io/v3"
+
+// Build channels in v3, from least to most trusted
+const (
+	ChannelAlpha       = "ALPHA"
+	ChannelBeta        = "BETA"
+	ChannelStable      = "STABLE"
+	ChannelRecommended = "RECOMMENDED"
+)
+
+type PaperV3API struct {
+	client *http.Client
+}
+
+// NewPaperV3API makes its requests with client, nil means one that goes through the API response cache
+func NewPaperV3API(client *http.Client) *PaperV3API {
+	if client == nil {
+		client = apiclient.NewCached()
+	}
+	return &PaperV3API{
+		client: client,
+	}
+}
+
+func (p *PaperV3API) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	// Fill requires a User-Agent
+	AddHeaders(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := apierror.CheckResponse(resp, "the Paper API"); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type ProjectV3Response struct {
+	Project struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"project"`
+	// Version group -> versions in it, newest first
+	Versions map[string][]string `json:"versions"`
+}
+
+func (p *PaperV3API) GetProject(ctx context.Context, projectID string) (*ProjectV3Response, error) {
+	var projectResponse ProjectV3Response
+	if err := p.get(ctx, baseURLV3+"/projects/"+projectID, &projectResponse); err != nil {
+		return nil, err
+	}
+	return &projectResponse, nil
+}
+
+type VersionV3 struct {
+	ID      string `json:"id"`
+	Support struct {
+		Status string `json:"status"`
+		End    string `json:"end"`
+	} `json:"support"`
+	Java struct {
+		Version struct {
+			Minimum int `json:"minimum"`
+		} `json:"version"`
+		Flags struct {
+			Recommended []string `json:"recommended"`
+		} `json:"flags"`
+	} `json:"java"`
+}
+
+type VersionV3Response struct {
+	Version VersionV3 `json:"version"`
+	// Build IDs, newest first
+	Builds []int `json:"builds"`
+}
+
+type VersionsV3Response struct {
+	Versions []VersionV3Response `json:"versions"`
+}
+
+// GetVersions returns every version of the project along with its Java requirement, newest first
+func (p *PaperV3API) GetVersions(ctx context.Context, projectID string) ([]VersionV3Response, error) {
+	var versionsResponse VersionsV3Response
+	if err := p.get(ctx, baseURLV3+"/projects/"+projectID+"/versions", &versionsResponse); err != nil {
+		return nil, err
+	}
+	return versionsResponse.Versions, nil
+}
+
+func (p *PaperV3API) GetVersion(ctx context.Context, projectID, version string) (*VersionV3Response, error) {
+	var versionResponse VersionV3Response
+	if err := p.get(ctx, baseURLV3+"/projects/"+projectID+"/versions/"+version, &versionResponse); err != nil {
+		return nil, apierror.VersionError(err, projectID, version)
+	}
+	return &versionResponse, nil
+}
+
+// GetRequiredJava returns the minimum Java major version needed to run the version
+func (p *PaperV3API) GetRequiredJava(ctx context.Context, projectID, version string) (int, error) {
+	versionResponse, err := p.GetVersion(ctx, projectID, version)
+	if err != nil {
+		return 0, err
+	}
+	if versionResponse.Version.Java.Version.Minimum == 0 {
+		return 0, fmt.Errorf("no Java version listed for %s %s", projectID, version)
+	}
+	return versionResponse.Version.Java.Version.Minimum, nil
+}
+
+type DownloadV3 struct {
+	Name      string `json:"name"`
+	Checksums struct {
+		Sha256 string `json:"sha256"`
+	} `json:"checksums"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"`
+}
+
+type BuildV3 struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	Commits []struct {
+		Sha     string    `json:"sha"`
+		Time    time.Time `json:"time"`
+		Message string    `json:"message"`
+	} `json:"commits"`
+	// Keyed by download type, the server jar is server:default
+	Downloads map[string]DownloadV3 `json:"downloads"`
+}
+
+// ServerDownload returns the server jar download of the build
+func (b *BuildV3) ServerDownload() (*DownloadV3, error) {
+	download, ok := b.Downloads["server:default"]
+	if !ok {
+		return nil, fmt.Errorf("build %d has no server download", b.ID)
+	}
+	return &download, nil
+}
+
+// GetBuilds returns the builds for the version, newest first. If channel isn't empty only builds on it are returned
+func (p *PaperV3API) GetBuilds(ctx context.Context, projectID, version, channel string) ([]BuildV3, error) {
+	buildsURL := baseURLV3 + "/projects/" + projectID + "/versions/" + version + "/builds"
+	if channel != "" {
+		buildsURL += "?channel=" + url.QueryEscape(channel)
+	}
+	var builds []BuildV3
+	if err := p.get(ctx, buildsURL, &builds); err != nil {
+		return nil, apierror.VersionError(err, projectID, version)
+	}
+	return builds, nil
+}
+
+func (p *PaperV3API) GetBuild(ctx context.Context, projectID, version string, build int) (*BuildV3, error) {
+	var buildResponse BuildV3
+	if err := p.get(ctx, baseURLV3+"/projects/"+projectID+"/versions/"+version+"/builds/"+strconv.Itoa(build), &buildResponse); err != nil {
+		return nil, apierror.VersionError(err, projectID, version)
+	}
+	return &buildResponse, nil
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+)
+
+// ChannelPolicy decides which builds we're willing to install
+type ChannelPolicy string
+
+const (
+	// ChannelPromoted only allows builds the project has promoted (recommended)
+	ChannelPromoted ChannelPolicy = "promoted"
+	// ChannelDefault allows any stable build, this is what we've always done
+	ChannelDefault ChannelPolicy = "default"
+	// ChannelExperimental allows anything
+	ChannelExperimental ChannelPolicy = "experimental"
+)
+
+var ChannelPolicies = []string{string(ChannelPromoted), string(ChannelDefault), string(ChannelExperimental)}
+
+func ParseChannelPolicy(policy string) (ChannelPolicy, error) {
+	switch ChannelPolicy(policy) {
+	case "":
+		return ChannelDefault, nil
+	case ChannelPromoted, ChannelDefault, ChannelExperimental:
+		return ChannelPolicy(policy), nil
+	}
+	return "", fmt.Errorf("unknown channel policy %s, it has to be promoted, default or experimental", policy)
+}
+
+// ChannelPolicyFor is ParseChannelPolicy, but it also makes sure the provider can honour the policy. Only some
+// projects promote builds, for the rest the promoted policy would never find anything
+func ChannelPolicyFor(p Provider, policy string) (ChannelPolicy, error) {
+	channelPolicy, err := ParseChannelPolicy(policy)
+	if err != nil {
+		return "", err
+	}
+	if promoter, ok := p.(Promoter); channelPolicy == ChannelPromoted && (!ok || !promoter.PromotesBuilds()) {
+		return "", fmt.Errorf("%s doesn't promote any builds, use the default or experimental channel", p.Name())
+	}
+	return channelPolicy, nil
+}
+
+// Allows checks the build is one the policy lets us install
+func (c ChannelPolicy) Allows(build Build) bool {
+	switch c {
+	case ChannelPromoted:
+		return build.Promoted
+	case ChannelExperimental:
+		return true
+	}
+	return build.Stable
+}
+
+// BuildGetter can be implemented by providers that can look up a single build, rather than going through them all
+type BuildGetter interface {
+	GetBuild(ctx context.Context, version, build string) (*Build, error)
+}
+
+// FindBuild looks up a specific build of the version, so a pinned build is known to exist before we download it
+func FindBuild(ctx context.Context, p Provider, version, build string) (*Build, error) {
+	if buildGetter, ok := p.(BuildGetter); ok {
+		return buildGetter.GetBuild(ctx, version, build)
+	}
+	builds, err := p.Builds(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	for i := range builds {
+		if builds[i].ID == build {
+			return &builds[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s %s doesn't have a build %s", p.Name(), version, build)
+}
@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"context"
+)
+
+// VersionInfo is what we show for each version when someone's picking one
+type VersionInfo struct {
+	Version string
+	// Whether the version has any stable builds, nil if we don't know
+	Stable *bool
+	// The Java major version the version needs, 0 if we don't know
+	Java int
+}
+
+// VersionDescriber is implemented by providers that can describe all their versions without a request for each one
+type VersionDescriber interface {
+	DescribeVersions(ctx context.Context) ([]VersionInfo, error)
+}
+
+// DescribeVersions returns every version the provider supports, oldest first. Providers that can't describe their
+// versions cheaply just get the version names, it'd take a request per version to find out the rest
+func DescribeVersions(ctx context.Context, p Provider) ([]VersionInfo, error) {
+	if describer, ok := p.(VersionDescriber); ok {
+		return describer.DescribeVersions(ctx)
+	}
+	versions, err := p.Versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]VersionInfo, 0, len(versions))
+	for _, version := range versions {
+		result = append(result, VersionInfo{Version: version})
+	}
+	return result, nil
+}
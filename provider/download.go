@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/cache"
+	"github.com/mja00/kami-chan-server-installer/download"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"log"
+	"os"
+	"strings"
+)
+
+// VerifyFile checks the file on disk has the expected checksum
+func VerifyFile(path string, checksum *Checksum) error {
+	if checksum == nil {
+		return nil
+	}
+	fileHash, err := utils.GetFileHash(path, checksum.Algorithm)
+	if err != nil {
+		return fmt.Errorf("error calculating %s hash: %s", checksum.Algorithm, err)
+	}
+	if !strings.EqualFold(fileHash, checksum.Value) {
+		return fmt.Errorf("%s hash of %s does not match, expected %s but got %s", checksum.Algorithm, path, checksum.Value, fileHash)
+	}
+	return nil
+}
+
+// Fetch downloads the file to outputPath, skipping it if the file is already there with the right hash
+func Fetch(ctx context.Context, dl *Download, outputPath string) error {
+	if _, err := os.Stat(outputPath); err == nil && dl.Checksum != nil {
+		if VerifyFile(outputPath, dl.Checksum) == nil {
+			log.Println("File already exists and hash matches, skipping download")
+			return nil
+		}
+	}
+	request := download.Request{
+		URL:         dl.URL,
+		Dest:        outputPath,
+		Description: "Downloading " + dl.FileName,
+	}
+	if dl.Checksum != nil {
+		request.Algorithm, request.Checksum = dl.Checksum.Algorithm, dl.Checksum.Value
+	}
+	// Another server on this machine might have downloaded it already, otherwise the downloader retries, resumes and
+	// only replaces outputPath once the hash matches
+	return cache.Download(ctx, download.New(), request)
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/fabric"
+	"net/http"
+)
+
+// Fabric builds are loader versions, so updating only ever bumps the loader
+type Fabric struct {
+	api    *fabric.FabricAPI
+	client *http.Client
+}
+
+func NewFabric(client *http.Client) *Fabric {
+	return &Fabric{
+		api:    fabric.NewFabricAPI(client),
+		client: client,
+	}
+}
+
+func init() {
+	Register("fabric", func(client *http.Client) Provider {
+		return NewFabric(client)
+	})
+}
+
+func (f *Fabric) Name() string {
+	return "fabric"
+}
+
+func (f *Fabric) IsModLoader() bool {
+	return true
+}
+
+// JarName is the launcher jar, it downloads the vanilla server itself on first start
+func (f *Fabric) JarName() string {
+	return "fabric-server-launch.jar"
+}
+
+func (f *Fabric) Versions(ctx context.Context) ([]string, error) {
+	gameVersions, err := f.api.GetGameVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Newest first and includes snapshots, we want stable releases oldest first
+	var versions []string
+	for i := len(gameVersions) - 1; i >= 0; i-- {
+		if gameVersions[i].Stable {
+			versions = append(versions, gameVersions[i].Version)
+		}
+	}
+	return versions, nil
+}
+
+func (f *Fabric) Builds(ctx context.Context, version string) ([]Build, error) {
+	loaderVersions, err := f.api.GetLoaderVersions(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	builds := make([]Build, 0, len(loaderVersions))
+	for i := len(loaderVersions) - 1; i >= 0; i-- {
+		loader := loaderVersions[i].Loader
+		builds = append(builds, Build{
+			ID:     loader.Version,
+			Stable: loader.Stable,
+		})
+	}
+	return builds, nil
+}
+
+func (f *Fabric) ResolveDownload(ctx context.Context, version, build string) (*Download, error) {
+	installerVersion, err := f.api.GetLatestInstallerVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Fabric meta doesn't publish hashes for the launcher jar, Install hashes it once it's downloaded instead
+	return &Download{
+		URL:      f.api.GetServerJarURL(version, build, installerVersion),
+		FileName: fmt.Sprintf("fabric-server-mc.%s-loader.%s-launcher.%s.jar", version, build, installerVersion),
+	}, nil
+}
+
+// RequiredJava comes from Mojang, Fabric runs on whatever the vanilla server needs
+func (f *Fabric) RequiredJava(ctx context.Context, version string) (int, error) {
+	return NewVanilla(f.client).RequiredJava(ctx, version)
+}
@@ -0,0 +1,278 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"github.com/mja00/kami-chan-server-installer/forge"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Forge and NeoForge only give us an installer, which has to be run to make the server. It leaves behind
+// run.sh/run.bat and user_jvm_args.txt, which is what we use to start the server instead of our own script
+
+// runForgeInstaller runs the installer headlessly in the server folder
+func runForgeInstaller(ctx context.Context, java, installerPath, serverDir string) error {
+	installerPath, err := filepath.Abs(installerPath)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, java, "-jar", installerPath, "--installServer")
+	cmd.Dir = serverDir
+	if err := utils.RunCommandAndPipeOutput(cmd); err != nil {
+		return fmt.Errorf("error running installer: %s", err)
+	}
+	// Versions older than 1.17 don't make a run script, we don't support those
+	if _, err := os.Stat(utils.GetStartScript(filepath.Join(serverDir, "run"))); err != nil {
+		return fmt.Errorf("installer didn't create a run script, only Minecraft 1.17 and newer are supported")
+	}
+	return nil
+}
+
+// sortVersions sorts the versions oldest first, anything we can't parse ends up at the start
+func sortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, errA := version.NewVersion(versions[i])
+		b, errB := version.NewVersion(versions[j])
+		if errA != nil || errB != nil {
+			return errA != nil && errB == nil
+		}
+		return a.LessThan(b)
+	})
+}
+
+type Forge struct {
+	api    *forge.ForgeAPI
+	client *http.Client
+	// Minecraft version -> Forge versions, oldest first
+	builds map[string][]string
+}
+
+func NewForge(client *http.Client) *Forge {
+	return &Forge{
+		api:    forge.NewForgeAPI(client),
+		client: client,
+	}
+}
+
+func init() {
+	Register("forge", func(client *http.Client) Provider {
+		return NewForge(client)
+	})
+	Register("neoforge", func(client *http.Client) Provider {
+		return NewNeoForge(client)
+	})
+}
+
+func (f *Forge) Name() string {
+	return "forge"
+}
+
+func (f *Forge) IsModLoader() bool {
+	return true
+}
+
+// PromotesBuilds is true as Forge has a recommended build for most Minecraft versions
+func (f *Forge) PromotesBuilds() bool {
+	return true
+}
+
+func (f *Forge) JarName() string {
+	return "forge-installer.jar"
+}
+
+func (f *Forge) getBuilds(ctx context.Context) (map[string][]string, error) {
+	if f.builds != nil {
+		return f.builds, nil
+	}
+	forgeVersions, err := f.api.GetForgeVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	minimumVersion := version.Must(version.NewVersion("1.17"))
+	builds := map[string][]string{}
+	for _, forgeVersion := range forgeVersions {
+		// These look like 1.20.1-47.3.0, old ones have more dashes but are too old for us anyway
+		split := strings.Split(forgeVersion, "-")
+		if len(split) != 2 {
+			continue
+		}
+		minecraftVersion, err := version.NewVersion(split[0])
+		if err != nil || minecraftVersion.LessThan(minimumVersion) {
+			continue
+		}
+		builds[split[0]] = append(builds[split[0]], split[1])
+	}
+	for _, forgeBuilds := range builds {
+		sortVersions(forgeBuilds)
+	}
+	f.builds = builds
+	return builds, nil
+}
+
+func (f *Forge) Versions(ctx context.Context) ([]string, error) {
+	builds, err := f.getBuilds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(builds))
+	for minecraftVersion := range builds {
+		versions = append(versions, minecraftVersion)
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+func (f *Forge) Builds(ctx context.Context, version string) ([]Build, error) {
+	builds, err := f.getBuilds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	forgeBuilds, ok := builds[version]
+	if !ok {
+		return nil, &apierror.VersionNotFoundError{Project: "forge", Version: version}
+	}
+	// The recommended build for each version is the promoted one
+	promotions, err := f.api.GetForgePromotions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recommended := promotions.Promos[version+"-recommended"]
+	result := make([]Build, 0, len(forgeBuilds))
+	for _, forgeBuild := range forgeBuilds {
+		result = append(result, Build{
+			ID:       forgeBuild,
+			Stable:   true,
+			Promoted: forgeBuild == recommended,
+		})
+	}
+	return result, nil
+}
+
+func (f *Forge) ResolveDownload(ctx context.Context, version, build string) (*Download, error) {
+	installerURL := f.api.GetForgeInstallerURL(version, build)
+	sha1, err := f.api.GetSha1(ctx, installerURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		URL:      installerURL,
+		FileName: fmt.Sprintf("forge-%s-%s-installer.jar", version, build),
+		Checksum: &Checksum{Algorithm: "sha1", Value: sha1},
+	}, nil
+}
+
+func (f *Forge) RunInstaller(ctx context.Context, java, installerPath, serverDir string) error {
+	return runForgeInstaller(ctx, java, installerPath, serverDir)
+}
+
+func (f *Forge) RequiredJava(ctx context.Context, version string) (int, error) {
+	return NewVanilla(f.client).RequiredJava(ctx, version)
+}
+
+type NeoForge struct {
+	api    *forge.ForgeAPI
+	client *http.Client
+	// NeoForge versions, oldest first
+	versions []string
+}
+
+func NewNeoForge(client *http.Client) *NeoForge {
+	return &NeoForge{
+		api:    forge.NewForgeAPI(client),
+		client: client,
+	}
+}
+
+func (n *NeoForge) Name() string {
+	return "neoforge"
+}
+
+func (n *NeoForge) IsModLoader() bool {
+	return true
+}
+
+func (n *NeoForge) JarName() string {
+	return "neoforge-installer.jar"
+}
+
+func (n *NeoForge) getVersions(ctx context.Context) ([]string, error) {
+	if n.versions != nil {
+		return n.versions, nil
+	}
+	versions, err := n.api.GetNeoForgeVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n.versions = versions
+	return versions, nil
+}
+
+func (n *NeoForge) Versions(ctx context.Context) ([]string, error) {
+	neoForgeVersions, err := n.getVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	seen := map[string]bool{}
+	for _, neoForgeVersion := range neoForgeVersions {
+		minecraftVersion := forge.NeoForgeToMinecraft(neoForgeVersion)
+		if minecraftVersion == "" || seen[minecraftVersion] {
+			continue
+		}
+		seen[minecraftVersion] = true
+		versions = append(versions, minecraftVersion)
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+func (n *NeoForge) Builds(ctx context.Context, version string) ([]Build, error) {
+	neoForgeVersions, err := n.getVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var builds []Build
+	for _, neoForgeVersion := range neoForgeVersions {
+		if forge.NeoForgeToMinecraft(neoForgeVersion) != version {
+			continue
+		}
+		// Betas are tagged on the end, e.g. 20.2.3-beta
+		builds = append(builds, Build{
+			ID:     neoForgeVersion,
+			Stable: !strings.Contains(neoForgeVersion, "-"),
+		})
+	}
+	if len(builds) == 0 {
+		return nil, &apierror.VersionNotFoundError{Project: "neoforge", Version: version}
+	}
+	return builds, nil
+}
+
+func (n *NeoForge) ResolveDownload(ctx context.Context, _, build string) (*Download, error) {
+	installerURL := n.api.GetNeoForgeInstallerURL(build)
+	sha1, err := n.api.GetSha1(ctx, installerURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		URL:      installerURL,
+		FileName: fmt.Sprintf("neoforge-%s-installer.jar", build),
+		Checksum: &Checksum{Algorithm: "sha1", Value: sha1},
+	}, nil
+}
+
+func (n *NeoForge) RunInstaller(ctx context.Context, java, installerPath, serverDir string) error {
+	return runForgeInstaller(ctx, java, installerPath, serverDir)
+}
+
+func (n *NeoForge) RequiredJava(ctx context.Context, version string) (int, error) {
+	return NewVanilla(n.client).RequiredJava(ctx, version)
+}
@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/paper"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PaperProject handles every project that's on the PaperMC API, they all share the same API. Everything comes from
+// Fill (v3)
+type PaperProject struct {
+	apiV3     *paper.PaperV3API
+	projectID string
+}
+
+func NewPaperProject(projectID string, client *http.Client) *PaperProject {
+	return &PaperProject{
+		apiV3:     paper.NewPaperV3API(client),
+		projectID: projectID,
+	}
+}
+
+func init() {
+	for _, projectID := range []string{"paper", "folia", "velocity", "waterfall"} {
+		projectID := projectID
+		Register(projectID, func(client *http.Client) Provider {
+			return NewPaperProject(projectID, client)
+		})
+	}
+}
+
+func (p *PaperProject) Name() string {
+	return p.projectID
+}
+
+// PromotesBuilds is true as the Paper team marks builds as recommended
+func (p *PaperProject) PromotesBuilds() bool {
+	return true
+}
+
+// Versions come from v3, newest first, so they get turned around
+func (p *PaperProject) Versions(ctx context.Context) ([]string, error) {
+	versions, err := p.apiV3.GetVersions(ctx, p.projectID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		result = append(result, versions[i].Version.ID)
+	}
+	return result, nil
+}
+
+func (p *PaperProject) Builds(ctx context.Context, version string) ([]Build, error) {
+	builds, err := p.apiV3.GetBuilds(ctx, p.projectID, version, "")
+	if err != nil {
+		return nil, err
+	}
+	// v3 gives us the newest first
+	result := make([]Build, 0, len(builds))
+	for i := len(builds) - 1; i >= 0; i-- {
+		result = append(result, paperBuild(&builds[i]))
+	}
+	return result, nil
+}
+
+func (p *PaperProject) ResolveDownload(ctx context.Context, version, build string) (*Download, error) {
+	buildInfo, err := p.getBuild(ctx, version, build)
+	if err != nil {
+		return nil, err
+	}
+	server, err := buildInfo.ServerDownload()
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		URL:      server.URL,
+		FileName: server.Name,
+		Checksum: &Checksum{Algorithm: "sha256", Value: server.Checksums.Sha256},
+	}, nil
+}
+
+func (p *PaperProject) RequiredJava(ctx context.Context, version string) (int, error) {
+	return p.apiV3.GetRequiredJava(ctx, p.projectID, version)
+}
+
+// DescribeVersions gets the versions and their Java from v3. v3 can only list builds one version at a time, so only
+// the newest versions get checked for stable builds, down to the first one that has some. That's what latest picks,
+// whether the older ones have stable builds is left unknown
+func (p *PaperProject) DescribeVersions(ctx context.Context) ([]VersionInfo, error) {
+	versions, err := p.apiV3.GetVersions(ctx, p.projectID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]VersionInfo, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i].Version
+		result = append(result, VersionInfo{
+			Version: version.ID,
+			Java:    version.Java.Version.Minimum,
+		})
+	}
+	for i := len(result) - 1; i >= 0; i-- {
+		builds, err := p.Builds(ctx, result[i].Version)
+		if err != nil {
+			return nil, err
+		}
+		hasStable := false
+		for _, build := range builds {
+			hasStable = hasStable || build.Stable
+		}
+		result[i].Stable = &hasStable
+		if hasStable {
+			break
+		}
+	}
+	return result, nil
+}
+
+// GetBuild checks the build exists with PaperV3API.GetBuild
+func (p *PaperProject) GetBuild(ctx context.Context, version, build string) (*Build, error) {
+	buildInfo, err := p.getBuild(ctx, version, build)
+	if err != nil {
+		return nil, err
+	}
+	result := paperBuild(buildInfo)
+	return &result, nil
+}
+
+func (p *PaperProject) getBuild(ctx context.Context, version, build string) (*paper.BuildV3, error) {
+	buildNumber, err := strconv.Atoi(build)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s build: %s", p.projectID, build)
+	}
+	return p.apiV3.GetBuild(ctx, p.projectID, version, buildNumber)
+}
+
+// paperBuild turns a v3 build into ours. Stable and recommended builds are what v2 called the default channel, and
+// recommended ones are the builds the Paper team promotes
+func paperBuild(build *paper.BuildV3) Build {
+	changes := make([]Change, 0, len(build.Commits))
+	for _, commit := range build.Commits {
+		summary, _, _ := strings.Cut(commit.Message, "\n")
+		changes = append(changes, Change{
+			Commit:  commit.Sha,
+			Summary: strings.TrimSpace(summary),
+			Message: commit.Message,
+		})
+	}
+	return Build{
+		ID:       strconv.Itoa(build.ID),
+		Time:     build.Time,
+		Channel:  strings.ToLower(build.Channel),
+		Stable:   build.Channel == paper.ChannelStable || build.Channel == paper.ChannelRecommended,
+		Promoted: build.Channel == paper.ChannelRecommended,
+		Changes:  changes,
+	}
+}
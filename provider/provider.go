@@ -0,0 +1,253 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"github.com/mja00/kami-chan-server-installer/utils"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This is the glue between the installer and the different server softwares we can install.
+// Each software (Paper, Folia, etc.) implements Provider and registers itself by name
+
+type Build struct {
+	ID      string
+	Time    time.Time
+	Channel string
+	// Stable builds are the ones we'll pick unless experimental builds are allowed
+	Stable bool
+	// Promoted builds are the ones the project recommends, the promoted channel policy only picks these
+	Promoted bool
+	// What changed in this build. Only the PaperMC projects tell us this
+	Changes []Change
+}
+
+type Change struct {
+	Commit  string
+	Summary string
+	Message string
+}
+
+type Checksum struct {
+	Algorithm string
+	Value     string
+}
+
+// ParseChecksum turns what Checksum.String gives back into a Checksum, an empty or invalid string gives nil
+func ParseChecksum(checksum string) *Checksum {
+	algorithm, value, ok := strings.Cut(checksum, ":")
+	if !ok || algorithm == "" || value == "" {
+		return nil
+	}
+	return &Checksum{Algorithm: algorithm, Value: value}
+}
+
+func (c *Checksum) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.Algorithm + ":" + c.Value
+}
+
+type Download struct {
+	URL      string
+	FileName string
+	// The hash the downloaded file is expected to have, nil if the software doesn't publish one
+	Checksum *Checksum
+}
+
+type Provider interface {
+	// Name is what's used for --software and stored in .kami.json
+	Name() string
+	// Versions returns all the Minecraft versions the software supports, oldest first
+	Versions(ctx context.Context) ([]string, error)
+	// Builds returns all the builds for a Minecraft version, oldest first
+	Builds(ctx context.Context, version string) ([]Build, error)
+	// ResolveDownload returns where a build can be downloaded from and the hash it should have
+	ResolveDownload(ctx context.Context, version, build string) (*Download, error)
+}
+
+// JavaRequirer is implemented by providers that know which Java version a Minecraft version needs
+type JavaRequirer interface {
+	RequiredJava(ctx context.Context, version string) (int, error)
+}
+
+// JarNamer is implemented by providers whose server jar shouldn't be saved as paper.jar
+type JarNamer interface {
+	JarName() string
+}
+
+// ModLoader is implemented by mod loaders. Their builds are loader versions, which get recorded in .kami.json
+type ModLoader interface {
+	IsModLoader() bool
+}
+
+// Promoter is implemented by providers that promote (recommend) some of their builds, which sets Build.Promoted
+type Promoter interface {
+	PromotesBuilds() bool
+}
+
+// Installer is implemented by software that gives us an installer to run rather than a server jar.
+// Running it with java sets the server up in serverDir along with its own start script
+type Installer interface {
+	RunInstaller(ctx context.Context, java, installerPath, serverDir string) error
+}
+
+var providers = map[string]func(client *http.Client) Provider{}
+
+// Register adds a provider. The factory makes its API requests with client, nil means the provider's usual clients
+func Register(name string, factory func(client *http.Client) Provider) {
+	providers[name] = factory
+}
+
+func Get(name string) (Provider, error) {
+	return GetWithClient(name, nil)
+}
+
+// GetWithClient is Get, but the provider makes all its API requests with client
+func GetWithClient(name string, client *http.Client) (Provider, error) {
+	factory, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown server software: %s", name)
+	}
+	return factory(client), nil
+}
+
+// Names returns the names of all the registered providers, sorted
+func Names() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func LatestVersion(ctx context.Context, p Provider) (string, error) {
+	versions, err := p.Versions(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no versions found for %s", p.Name())
+	}
+	return versions[len(versions)-1], nil
+}
+
+// LatestBuild returns the newest build the channel policy allows for the version
+func LatestBuild(ctx context.Context, p Provider, version string, policy ChannelPolicy) (*Build, error) {
+	builds, err := p.Builds(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(builds) - 1; i >= 0; i-- {
+		if policy.Allows(builds[i]) {
+			return &builds[i], nil
+		}
+	}
+	if len(builds) == 0 {
+		return nil, &apierror.NoBuildsError{Project: p.Name(), Version: version}
+	}
+	// If we don't have a build, then they were all experimental builds (probably a new MC release), or none of them
+	// were promoted
+	return nil, &apierror.NoBuildsError{Project: p.Name(), Version: version, Channel: string(policy)}
+}
+
+// RequiredJava returns the Java major version needed to run the version
+func RequiredJava(ctx context.Context, p Provider, version string) (int, error) {
+	if javaRequirer, ok := p.(JavaRequirer); ok {
+		return javaRequirer.RequiredJava(ctx, version)
+	}
+	return 0, fmt.Errorf("%s doesn't say which Java version it needs", p.Name())
+}
+
+// JarName is the file name the server jar is saved as in the server folder
+func JarName(p Provider) string {
+	if jarNamer, ok := p.(JarNamer); ok {
+		return jarNamer.JarName()
+	}
+	return "paper.jar"
+}
+
+// LoaderVersion returns the loader version for a build, or an empty string if the provider isn't a mod loader
+func LoaderVersion(p Provider, build string) string {
+	if modLoader, ok := p.(ModLoader); ok && modLoader.IsModLoader() {
+		return build
+	}
+	return ""
+}
+
+// IsNewer checks if candidate comes after current in the version's build list
+func IsNewer(ctx context.Context, p Provider, version, current, candidate string) (bool, error) {
+	builds, err := p.Builds(ctx, version)
+	if err != nil {
+		return false, err
+	}
+	currentIndex, candidateIndex := -1, -1
+	for i, build := range builds {
+		if build.ID == current {
+			currentIndex = i
+		}
+		if build.ID == candidate {
+			candidateIndex = i
+		}
+	}
+	return candidateIndex > currentIndex, nil
+}
+
+// Changelog returns the builds after from, up to and including to, oldest first. If from isn't one of the version's
+// builds, e.g. it's from another Minecraft version, every build up to to is returned
+func Changelog(ctx context.Context, p Provider, version, from, to string) ([]Build, error) {
+	builds, err := p.Builds(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	start, end := 0, -1
+	for i, build := range builds {
+		if build.ID == from {
+			start = i + 1
+		}
+		if build.ID == to {
+			end = i
+		}
+	}
+	if end == -1 {
+		return nil, fmt.Errorf("%s %s doesn't have a build %s", p.Name(), version, to)
+	}
+	if start > end {
+		return nil, nil
+	}
+	return builds[start : end+1], nil
+}
+
+// Install downloads the build to outputPath and returns what was downloaded. installed is the checksum recorded the
+// last time this exact build was installed, if it was. It lets us skip downloading software that doesn't publish
+// hashes, and the jar gets hashed after it's downloaded so there's always a checksum to record
+func Install(ctx context.Context, p Provider, version, build, outputPath string, installed *Checksum) (*Download, error) {
+	download, err := p.ResolveDownload(ctx, version, build)
+	if err != nil {
+		return nil, err
+	}
+	if download.Checksum != nil {
+		return download, Fetch(ctx, download, outputPath)
+	}
+	if installed != nil && VerifyFile(outputPath, installed) == nil {
+		log.Println("File already exists and hash matches what was installed, skipping download")
+		download.Checksum = installed
+		return download, nil
+	}
+	if err := Fetch(ctx, download, outputPath); err != nil {
+		return nil, err
+	}
+	sha256, err := utils.GetSha256Hash(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	download.Checksum = &Checksum{Algorithm: "sha256", Value: sha256}
+	return download, nil
+}
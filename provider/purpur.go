@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/purpur"
+	"net/http"
+)
+
+type Purpur struct {
+	api    *purpur.PurpurAPI
+	client *http.Client
+}
+
+func NewPurpur(client *http.Client) *Purpur {
+	return &Purpur{
+		api:    purpur.NewPurpurAPI(client),
+		client: client,
+	}
+}
+
+func init() {
+	Register("purpur", func(client *http.Client) Provider {
+		return NewPurpur(client)
+	})
+}
+
+func (p *Purpur) Name() string {
+	return "purpur"
+}
+
+func (p *Purpur) Versions(ctx context.Context) ([]string, error) {
+	project, err := p.api.GetProject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return project.Versions, nil
+}
+
+func (p *Purpur) Builds(ctx context.Context, version string) ([]Build, error) {
+	versionInfo, err := p.api.GetVersion(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	// Purpur only lists builds that went through, and it doesn't have channels
+	builds := make([]Build, 0, len(versionInfo.Builds.All))
+	for _, build := range versionInfo.Builds.All {
+		builds = append(builds, Build{
+			ID:     build,
+			Stable: true,
+		})
+	}
+	return builds, nil
+}
+
+func (p *Purpur) ResolveDownload(ctx context.Context, version, build string) (*Download, error) {
+	buildInfo, err := p.api.GetBuild(ctx, version, build)
+	if err != nil {
+		return nil, err
+	}
+	if buildInfo.Result != "SUCCESS" {
+		return nil, fmt.Errorf("purpur build %s for %s didn't succeed (%s)", build, version, buildInfo.Result)
+	}
+	return &Download{
+		URL:      p.api.GetBuildDownloadURL(version, build),
+		FileName: fmt.Sprintf("purpur-%s-%s.jar", version, build),
+		Checksum: &Checksum{Algorithm: "md5", Value: buildInfo.Md5},
+	}, nil
+}
+
+// RequiredJava comes from Mojang, Purpur runs on whatever the vanilla server needs
+func (p *Purpur) RequiredJava(ctx context.Context, version string) (int, error) {
+	return NewVanilla(p.client).RequiredJava(ctx, version)
+}
@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"regexp"
+	"strings"
+)
+
+// Version selectors let people ask for a version without knowing exactly which one they want:
+//   latest, latest-stable        the newest version that has a stable build
+//   latest-experimental          the newest version, even if it only has experimental builds
+//   1.20                         the newest 1.20.x
+//   ~1.21.3                      the newest 1.21.x that's at least 1.21.3
+//   >= 1.20, < 1.21              any go-version constraint, the newest match wins
+//   1.20.4 or =1.20              exactly that version
+
+var versionPattern = regexp.MustCompile(`^\d+\.\d+(\.\d+)?(-[0-9A-Za-z.]+)?$`)
+
+// ResolveVersion turns a selector into a version the provider has
+func ResolveVersion(ctx context.Context, p Provider, selector string) (string, error) {
+	selector = strings.TrimSpace(selector)
+	switch selector {
+	case "", "latest", "latest-stable":
+		return latestStableVersion(ctx, p)
+	case "latest-experimental":
+		return LatestVersion(ctx, p)
+	}
+	exact, constraints, err := parseSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	// Exact versions are passed through, the provider's own error for a missing version is more useful than ours
+	if exact != "" {
+		return exact, nil
+	}
+	versions, err := p.Versions(ctx)
+	if err != nil {
+		return "", err
+	}
+	newest := newestMatch(versions, constraints)
+	if newest == "" {
+		return "", fmt.Errorf("%s has no version matching %s", p.Name(), selector)
+	}
+	return newest, nil
+}
+
+// newestMatch returns the newest of the versions that meets the constraints, or an empty string if none do
+func newestMatch(versions []string, constraints version.Constraints) string {
+	var newest *version.Version
+	var newestName string
+	for _, name := range versions {
+		v, err := version.NewVersion(name)
+		// Snapshots and pre-releases only get picked when asked for by name
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		if constraints.Check(v) && (newest == nil || v.GreaterThan(newest)) {
+			newest = v
+			newestName = name
+		}
+	}
+	return newestName
+}
+
+// ValidateVersionSelector checks the selector makes sense, without looking up any versions
+func ValidateVersionSelector(selector string) error {
+	switch strings.TrimSpace(selector) {
+	case "", "latest", "latest-experimental", "latest-stable":
+		return nil
+	}
+	_, _, err := parseSelector(strings.TrimSpace(selector))
+	return err
+}
+
+// ValidateVersionSelectorAgainst checks the selector makes sense and that something in versions matches it
+func ValidateVersionSelectorAgainst(versions []string, selector string) error {
+	selector = strings.TrimSpace(selector)
+	switch selector {
+	case "", "latest", "latest-experimental", "latest-stable":
+		return nil
+	}
+	exact, constraints, err := parseSelector(selector)
+	if err != nil {
+		return err
+	}
+	if exact != "" {
+		for _, v := range versions {
+			if v == exact {
+				return nil
+			}
+		}
+		return fmt.Errorf("there's no Minecraft %s", exact)
+	}
+	if newestMatch(versions, constraints) == "" {
+		return fmt.Errorf("no Minecraft version matches %s", selector)
+	}
+	return nil
+}
+
+// parseSelector returns either the exact version that was asked for, or the constraints a version has to meet
+func parseSelector(selector string) (string, version.Constraints, error) {
+	if strings.HasPrefix(selector, "=") && !strings.HasPrefix(selector, "==") {
+		exact := strings.TrimSpace(selector[1:])
+		if !versionPattern.MatchString(exact) {
+			return "", nil, fmt.Errorf("invalid Minecraft version: %s", exact)
+		}
+		return exact, nil, nil
+	}
+	if strings.HasPrefix(selector, "~") && !strings.HasPrefix(selector, "~>") {
+		base, err := version.NewVersion(strings.TrimSpace(selector[1:]))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid Minecraft version: %s", selector)
+		}
+		constraints, err := minorRange(base)
+		return "", constraints, err
+	}
+	if strings.ContainsAny(selector, "<>=!~,") {
+		constraints, err := version.NewConstraint(selector)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid version selector %s: %s", selector, err)
+		}
+		return "", constraints, nil
+	}
+	v, err := version.NewVersion(selector)
+	if err != nil || !versionPattern.MatchString(selector) {
+		return "", nil, fmt.Errorf("invalid Minecraft version: %s", selector)
+	}
+	// 1.20 means the 1.20 line, anything more specific is an exact version
+	if strings.Count(selector, ".") == 1 && v.Prerelease() == "" {
+		constraints, err := minorRange(v)
+		return "", constraints, err
+	}
+	return selector, nil, nil
+}
+
+// minorRange is every version from base up to the next minor version, so 1.21.3 gives >= 1.21.3, < 1.22
+func minorRange(base *version.Version) (version.Constraints, error) {
+	segments := base.Segments()
+	return version.NewConstraint(fmt.Sprintf(">= %s, < %d.%d", base.String(), segments[0], segments[1]+1))
+}
+
+// latestStableVersion goes back from the newest version until it finds one with a stable build
+func latestStableVersion(ctx context.Context, p Provider) (string, error) {
+	versions, err := p.Versions(ctx)
+	if err != nil {
+		return "", err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		builds, err := p.Builds(ctx, versions[i])
+		if err != nil {
+			return "", err
+		}
+		for _, build := range builds {
+			if build.Stable {
+				return versions[i], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s has no version with a stable build", p.Name())
+}
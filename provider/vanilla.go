@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"github.com/mja00/kami-chan-server-installer/mojang"
+	"net/http"
+)
+
+type Vanilla struct {
+	api      *mojang.MojangAPI
+	manifest *mojang.ManifestResponse
+	versions map[string]*mojang.VersionResponse
+}
+
+func NewVanilla(client *http.Client) *Vanilla {
+	return &Vanilla{
+		api:      mojang.NewMojangAPI(client),
+		versions: map[string]*mojang.VersionResponse{},
+	}
+}
+
+func init() {
+	Register("vanilla", func(client *http.Client) Provider {
+		return NewVanilla(client)
+	})
+}
+
+func (v *Vanilla) Name() string {
+	return "vanilla"
+}
+
+// PromotesBuilds is true as releases count as promoted, snapshots don't
+func (v *Vanilla) PromotesBuilds() bool {
+	return true
+}
+
+// getManifest only grabs the manifest once, everything we do needs it
+func (v *Vanilla) getManifest(ctx context.Context) (*mojang.ManifestResponse, error) {
+	if v.manifest != nil {
+		return v.manifest, nil
+	}
+	manifest, err := v.api.GetManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v.manifest = manifest
+	return manifest, nil
+}
+
+func (v *Vanilla) getVersion(ctx context.Context, version string) (*mojang.VersionResponse, error) {
+	if versionInfo, ok := v.versions[version]; ok {
+		return versionInfo, nil
+	}
+	manifest, err := v.getManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, manifestVersion := range manifest.Versions {
+		if manifestVersion.ID == version {
+			versionInfo, err := v.api.GetVersion(ctx, manifestVersion)
+			if err != nil {
+				return nil, err
+			}
+			v.versions[version] = versionInfo
+			return versionInfo, nil
+		}
+	}
+	return nil, &apierror.VersionNotFoundError{Project: "vanilla", Version: version}
+}
+
+func (v *Vanilla) Versions(ctx context.Context) ([]string, error) {
+	manifest, err := v.getManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The manifest is newest first and has snapshots in it, we only want releases
+	var versions []string
+	for i := len(manifest.Versions) - 1; i >= 0; i-- {
+		if manifest.Versions[i].Type == "release" {
+			versions = append(versions, manifest.Versions[i].ID)
+		}
+	}
+	return versions, nil
+}
+
+// Builds for vanilla is just the version itself, Mojang only ever has one server jar per version
+func (v *Vanilla) Builds(ctx context.Context, version string) ([]Build, error) {
+	manifest, err := v.getManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, manifestVersion := range manifest.Versions {
+		if manifestVersion.ID == version {
+			return []Build{{
+				ID:      manifestVersion.ID,
+				Time:    manifestVersion.ReleaseTime,
+				Channel: manifestVersion.Type,
+				Stable:  manifestVersion.Type == "release",
+				// There's only ever one build of a release, so it's as recommended as it gets
+				Promoted: manifestVersion.Type == "release",
+			}}, nil
+		}
+	}
+	return nil, &apierror.VersionNotFoundError{Project: "vanilla", Version: version}
+}
+
+func (v *Vanilla) ResolveDownload(ctx context.Context, version, _ string) (*Download, error) {
+	versionInfo, err := v.getVersion(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	if versionInfo.Downloads.Server == nil {
+		return nil, fmt.Errorf("minecraft %s doesn't have a server download", version)
+	}
+	return &Download{
+		URL:      versionInfo.Downloads.Server.URL,
+		FileName: fmt.Sprintf("minecraft_server.%s.jar", version),
+		Checksum: &Checksum{Algorithm: "sha1", Value: versionInfo.Downloads.Server.Sha1},
+	}, nil
+}
+
+func (v *Vanilla) RequiredJava(ctx context.Context, version string) (int, error) {
+	versionInfo, err := v.getVersion(ctx, version)
+	if err != nil {
+		return 0, err
+	}
+	// Really old versions don't say, they all run on Java 8
+	if versionInfo.JavaVersion.MajorVersion == 0 {
+		return 8, nil
+	}
+	return versionInfo.JavaVersion.MajorVersion, nil
+}
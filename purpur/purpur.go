@@ -0,0 +1,114 @@
+package purpur
+
+import (
+	"context"
+	"github.com/goccy/go-json"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/apierror"
+	"net/http"
+)
+
+// This will handle all of our API calls to the Purpur API
+
+var Version = "dev"
+var Commit = "none"
+
+const baseURL = "https://api.purpurmc.org/v2"
+
+type PurpurAPI struct {
+	client *http.Client
+}
+
+// NewPurpurAPI makes its requests with client, nil means apiclient.New()
+func NewPurpurAPI(client *http.Client) *PurpurAPI {
+	if client == nil {
+		client = apiclient.New()
+	}
+	return &PurpurAPI{
+		client: client,
+	}
+}
+
+func AddHeaders(req *http.Request) {
+	req.Header.Add("User-Agent", "Kami Chan Server Installer"+"/"+Version+"/"+Commit)
+}
+
+func (p *PurpurAPI) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	AddHeaders(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := apierror.CheckResponse(resp, "the Purpur API"); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type ProjectResponse struct {
+	Project  string `json:"project"`
+	Metadata struct {
+		Current string `json:"current"`
+	} `json:"metadata"`
+	Versions []string `json:"versions"`
+}
+
+func (p *PurpurAPI) GetProject(ctx context.Context) (*ProjectResponse, error) {
+	var projectResponse ProjectResponse
+	if err := p.get(ctx, baseURL+"/purpur", &projectResponse); err != nil {
+		return nil, err
+	}
+	return &projectResponse, nil
+}
+
+type VersionResponse struct {
+	Project string `json:"project"`
+	Version string `json:"version"`
+	Builds  struct {
+		Latest string   `json:"latest"`
+		All    []string `json:"all"`
+	} `json:"builds"`
+}
+
+func (p *PurpurAPI) GetVersion(ctx context.Context, version string) (*VersionResponse, error) {
+	var versionResponse VersionResponse
+	if err := p.get(ctx, baseURL+"/purpur/"+version, &versionResponse); err != nil {
+		return nil, apierror.VersionError(err, "purpur", version)
+	}
+	return &versionResponse, nil
+}
+
+type BuildResponse struct {
+	Project   string `json:"project"`
+	Version   string `json:"version"`
+	Build     string `json:"build"`
+	Result    string `json:"result"`
+	Timestamp int64  `json:"timestamp"`
+	Duration  int64  `json:"duration"`
+	Commits   []struct {
+		Author      string `json:"author"`
+		Email       string `json:"email"`
+		Description string `json:"description"`
+		Hash        string `json:"hash"`
+		Timestamp   int64  `json:"timestamp"`
+	} `json:"commits"`
+	Md5 string `json:"md5"`
+}
+
+func (p *PurpurAPI) GetBuild(ctx context.Context, version, build string) (*BuildResponse, error) {
+	var buildResponse BuildResponse
+	if err := p.get(ctx, baseURL+"/purpur/"+version+"/"+build, &buildResponse); err != nil {
+		return nil, err
+	}
+	return &buildResponse, nil
+}
+
+func (p *PurpurAPI) GetBuildDownloadURL(version, build string) string {
+	return baseURL + "/purpur/" + version + "/" + build + "/download"
+}
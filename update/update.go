@@ -1,10 +1,11 @@
 package update
 
 import (
+	"context"
 	"github.com/goccy/go-json"
 	"github.com/hashicorp/go-version"
-	"github.com/schollz/progressbar/v3"
-	"io"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/download"
 	"log"
 	"net/http"
 	"os"
@@ -88,14 +89,24 @@ type GithubRelease struct {
 	Body       string `json:"body"`
 }
 
-func CheckForUpdates() (bool, error) {
+// get makes a GET request that gives up when ctx is cancelled or after apiclient.Timeout
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// GitHub only lets us make 60 requests an hour, but answering "not modified" doesn't count towards that
+	return apiclient.NewCached().Do(req)
+}
+
+func CheckForUpdates(ctx context.Context) (bool, error) {
 	log.Println("Checking for updates...")
 	if Version == "dev" {
 		return false, nil
 	}
 	githubAPI := "https://api.github.com/repos/mja00/kami-chan-server-installer/releases/latest"
 	// Make the request
-	resp, err := http.Get(githubAPI)
+	resp, err := get(ctx, githubAPI)
 	if err != nil {
 		return false, err
 	}
@@ -117,7 +128,7 @@ func CheckForUpdates() (bool, error) {
 	return false, nil
 }
 
-func DownloadUpdate(url string) error {
+func DownloadUpdate(ctx context.Context, url string) error {
 	// Stream the file into our temp directory
 	// Create the temp directory if it doesn't exist
 	if _, err := os.Stat("temp"); os.IsNotExist(err) {
@@ -126,27 +137,9 @@ func DownloadUpdate(url string) error {
 			return err
 		}
 	}
-	out, err := os.Create(filepath.Join("temp", "update.tar.gz"))
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	bar := progressbar.DefaultBytes(
-		resp.ContentLength,
-		"Downloading update",
-	)
-
-	_, err = io.Copy(io.MultiWriter(out, bar), resp.Body)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return download.New().Download(ctx, download.Request{
+		URL:         url,
+		Dest:        filepath.Join("temp", "update.tar.gz"),
+		Description: "Downloading update",
+	})
 }
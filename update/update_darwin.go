@@ -1,14 +1,14 @@
 package update
 
 import (
+	"context"
 	"github.com/goccy/go-json"
 	"github.com/mja00/kami-chan-server-installer/utils"
-	"net/http"
 	"os"
 	"path/filepath"
 )
 
-func GetUpdateURL() string {
+func GetUpdateURL(ctx context.Context) string {
 	arch := utils.GetArch()
 	var neededAsset string
 	switch arch {
@@ -21,7 +21,7 @@ func GetUpdateURL() string {
 	}
 	githubAPI := "https://api.github.com/repos/mja00/kami-chan-server-installer/releases/latest"
 	// Make the request
-	resp, err := http.Get(githubAPI)
+	resp, err := get(ctx, githubAPI)
 	if err != nil {
 		return ""
 	}
@@ -47,7 +47,10 @@ func InstallUpdate() error {
 		return err
 	}
 	defer file.Close()
-	utils.ExtractTarGz(file, filepath.Join("temp", "update"))
+	err = utils.ExtractTarGz(file, filepath.Join("temp", "update"))
+	if err != nil {
+		return err
+	}
 	_ = os.RemoveAll(filepath.Join("temp", "update.tar.gz"))
 	// Move the binary to the main directory, overwriting the old one
 	err = os.Rename(filepath.Join("temp", "update", "kami-chan-server-installer"), "kami-chan-server-installer")
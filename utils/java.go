@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Portable JDKs are plain archives we extract next to the server (or into a shared folder), so they don't need root
+// and every server can have whichever Java it needs
+
+// JavaProbeTimeout is how long we wait for java to tell us about itself, a broken install could hang forever
+const JavaProbeTimeout = 10 * time.Second
+
+// GetJavaVersionAt is GetJavaVersion for a specific java binary
+func GetJavaVersionAt(javaPath string) (JavaVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), JavaProbeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, javaPath, "-version").CombinedOutput()
+	if err != nil {
+		return JavaVersion{Version: "unknown"}, err
+	}
+	// The version is the bit in quotes on the first line, e.g. openjdk version "21.0.3" 2024-04-16 LTS
+	quoted := strings.Split(string(output), "\"")
+	if len(quoted) < 2 {
+		return JavaVersion{Version: "unknown"}, fmt.Errorf("couldn't find a version in: %s", strings.TrimSpace(string(output)))
+	}
+	return ParseJavaVersion(quoted[1])
+}
+
+// ParseJavaVersion turns 21.0.3, 17 or the old 1.8.0_402 style into a JavaVersion
+func ParseJavaVersion(version string) (JavaVersion, error) {
+	versionSplit := strings.FieldsFunc(version, func(r rune) bool {
+		return r == '.' || r == '_' || r == '+' || r == '-'
+	})
+	if len(versionSplit) == 0 {
+		return JavaVersion{}, fmt.Errorf("invalid Java version: %s", version)
+	}
+	major, err := strconv.Atoi(versionSplit[0])
+	if err != nil {
+		return JavaVersion{}, fmt.Errorf("invalid Java version: %s", version)
+	}
+	minor, patch := 0, 0
+	if len(versionSplit) > 1 {
+		minor, _ = strconv.Atoi(versionSplit[1])
+	}
+	if len(versionSplit) > 2 {
+		patch, _ = strconv.Atoi(versionSplit[2])
+	}
+	// Java 8 and older call themselves 1.x, with the update after the underscore
+	if major == 1 {
+		major, minor, patch = minor, 0, 0
+		if len(versionSplit) > 3 {
+			patch, _ = strconv.Atoi(versionSplit[3])
+		}
+	}
+	return JavaVersion{Version: version, Major: major, Minor: minor, Patch: patch}, nil
+}
+
+// CorrettoArchiveURL is where the latest Corretto JDK archive for the OS (a GOOS value) and arch (x64 or aarch64) lives.
+// Unlike CorrettoURL these just need extracting rather than installing
+func CorrettoArchiveURL(version int, goos, arch string) (string, error) {
+	switch goos {
+	case "linux":
+		return fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-%s-linux-jdk.tar.gz", version, arch), nil
+	case "darwin":
+		return fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-%s-macos-jdk.tar.gz", version, arch), nil
+	case "windows":
+		return fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-%s-windows-jdk.zip", version, arch), nil
+	}
+	return "", fmt.Errorf("unsupported OS: %s", goos)
+}
+
+// PortableJavaName is the folder a portable JDK for the Java version goes in
+func PortableJavaName(version int) string {
+	return fmt.Sprintf("java-%d-%s", version, GetArch())
+}
+
+// JavaBinary is where java lives inside a JDK
+func JavaBinary(javaHome string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(javaHome, "bin", "java.exe")
+	}
+	return filepath.Join(javaHome, "bin", "java")
+}
+
+// FindPortableJava returns the java binary of a portable JDK we've already extracted to dir, or an empty string
+func FindPortableJava(dir string) string {
+	javaHome, err := findJavaHome(dir)
+	if err != nil {
+		return ""
+	}
+	return JavaBinary(javaHome)
+}
+
+// DownloadPortableJava downloads the JDK archive for the Java version, returning where it was saved and where it came from
+func DownloadPortableJava(ctx context.Context, version int) (string, string, error) {
+	javaURL, err := CorrettoArchiveURL(version, runtime.GOOS, GetArch())
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll("temp", 0755); err != nil {
+		return "", "", err
+	}
+	extension := ".tar.gz"
+	if strings.HasSuffix(javaURL, ".zip") {
+		extension = ".zip"
+	}
+	javaPath := filepath.Join("temp", PortableJavaName(version)+extension)
+	javaURL, err = DownloadCorretto(ctx, javaURL, javaPath)
+	if err != nil {
+		return "", "", err
+	}
+	return javaPath, javaURL, nil
+}
+
+// ExtractPortableJava extracts the JDK archive to dir and returns the java binary inside it
+func ExtractPortableJava(archivePath, dir string) (string, error) {
+	// Extract next to where it's going first, that way a failed extract never leaves half a JDK behind
+	tmp := dir + ".tmp"
+	_ = os.RemoveAll(tmp)
+	defer os.RemoveAll(tmp)
+	if strings.HasSuffix(archivePath, ".zip") {
+		if err := ExtractZip(archivePath, tmp); err != nil {
+			return "", err
+		}
+	} else {
+		file, err := os.Open(archivePath)
+		if err != nil {
+			return "", err
+		}
+		err = ExtractTarGz(file, tmp)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := findJavaHome(tmp); err != nil {
+		return "", err
+	}
+	_ = os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	javaHome, err := findJavaHome(dir)
+	if err != nil {
+		return "", err
+	}
+	return JavaBinary(javaHome), nil
+}
+
+// findJavaHome finds the JDK inside dir. Archives put it in a folder named after the exact version, and on macOS
+// it's further down in Contents/Home
+func findJavaHome(dir string) (string, error) {
+	javaHome := ""
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		relative, _ := filepath.Rel(dir, path)
+		if strings.Count(relative, string(filepath.Separator)) > 3 {
+			return filepath.SkipDir
+		}
+		if info, err := os.Stat(JavaBinary(path)); err == nil && !info.IsDir() {
+			javaHome = path
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if javaHome == "" {
+		return "", fmt.Errorf("couldn't find a JDK in %s", dir)
+	}
+	return javaHome, nil
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Finding every Java on the machine, so we can pick one that fits rather than just whatever java is on the PATH
+
+type JavaRuntime struct {
+	// The java binary
+	Path    string
+	Version JavaVersion
+	Vendor  string
+	// x64 or aarch64, like GetArch
+	Arch string
+	// Where we found it: JAVA_HOME, PATH, system, SDKMAN, asdf or installer
+	Source string
+}
+
+// DiscoverJava finds every Java runtime we can. runtimeDirs are folders we've extracted portable JDKs into, each JDK
+// in its own folder. If the same runtime turns up more than once, the first place we found it wins
+func DiscoverJava(runtimeDirs ...string) []JavaRuntime {
+	var runtimes []JavaRuntime
+	seen := map[string]bool{}
+	add := func(javaPath, source string) {
+		javaPath, err := filepath.Abs(javaPath)
+		if err != nil {
+			return
+		}
+		resolved, err := filepath.EvalSymlinks(javaPath)
+		if err != nil || seen[resolved] {
+			return
+		}
+		seen[resolved] = true
+		javaRuntime, err := ProbeJava(javaPath)
+		if err != nil {
+			return
+		}
+		javaRuntime.Source = source
+		runtimes = append(runtimes, javaRuntime)
+	}
+	if javaHome := os.Getenv("JAVA_HOME"); javaHome != "" {
+		add(JavaBinary(javaHome), "JAVA_HOME")
+	}
+	if javaPath, err := exec.LookPath("java"); err == nil {
+		add(javaPath, "PATH")
+	}
+	for _, javaHome := range javaHomesIn(systemJavaDirs()...) {
+		add(JavaBinary(javaHome), "system")
+	}
+	home, _ := os.UserHomeDir()
+	sdkmanDir := os.Getenv("SDKMAN_DIR")
+	if sdkmanDir == "" && home != "" {
+		sdkmanDir = filepath.Join(home, ".sdkman")
+	}
+	for _, javaHome := range javaHomesIn(filepath.Join(sdkmanDir, "candidates", "java")) {
+		add(JavaBinary(javaHome), "SDKMAN")
+	}
+	asdfDir := os.Getenv("ASDF_DATA_DIR")
+	if asdfDir == "" && home != "" {
+		asdfDir = filepath.Join(home, ".asdf")
+	}
+	for _, javaHome := range javaHomesIn(filepath.Join(asdfDir, "installs", "java")) {
+		add(JavaBinary(javaHome), "asdf")
+	}
+	for _, runtimeDir := range runtimeDirs {
+		entries, _ := os.ReadDir(runtimeDir)
+		for _, entry := range entries {
+			if javaPath := FindPortableJava(filepath.Join(runtimeDir, entry.Name())); entry.IsDir() && javaPath != "" {
+				add(javaPath, "installer")
+			}
+		}
+	}
+	return runtimes
+}
+
+// systemJavaDirs are the folders the OS's packages and installers put JDKs in
+func systemJavaDirs() []string {
+	switch runtime.GOOS {
+	case "linux":
+		return []string{"/usr/lib/jvm"}
+	case "darwin":
+		return []string{"/Library/Java/JavaVirtualMachines"}
+	case "windows":
+		var dirs []string
+		for _, programFiles := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)")} {
+			if programFiles == "" {
+				continue
+			}
+			for _, vendor := range []string{"Java", "Amazon Corretto", "Eclipse Adoptium", "Microsoft", "Zulu"} {
+				dirs = append(dirs, filepath.Join(programFiles, vendor))
+			}
+		}
+		return dirs
+	}
+	return nil
+}
+
+// javaHomesIn returns the JDKs directly inside the dirs. macOS keeps the actual JDK in Contents/Home
+func javaHomesIn(dirs ...string) []string {
+	var javaHomes []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			// SDKMAN has a current link to whichever one is in use, which we'll find anyway
+			if entry.Name() == "current" {
+				continue
+			}
+			javaHome := filepath.Join(dir, entry.Name())
+			if _, err := os.Stat(JavaBinary(javaHome)); err == nil {
+				javaHomes = append(javaHomes, javaHome)
+			} else if _, err := os.Stat(JavaBinary(filepath.Join(javaHome, "Contents", "Home"))); err == nil {
+				javaHomes = append(javaHomes, filepath.Join(javaHome, "Contents", "Home"))
+			}
+		}
+	}
+	return javaHomes
+}
+
+// ProbeJava runs the java binary to find out its version, vendor and architecture
+func ProbeJava(javaPath string) (JavaRuntime, error) {
+	// Asking for the properties gets us all three in one go, they're printed like "    java.vendor = Amazon.com Inc."
+	ctx, cancel := context.WithTimeout(context.Background(), JavaProbeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, javaPath, "-XshowSettings:properties", "-version").CombinedOutput()
+	if err != nil {
+		return JavaRuntime{}, err
+	}
+	properties := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " = ")
+		if ok {
+			properties[key] = strings.TrimSpace(value)
+		}
+	}
+	var version JavaVersion
+	if properties["java.version"] != "" {
+		version, err = ParseJavaVersion(properties["java.version"])
+	} else {
+		// Something that doesn't know -XshowSettings, fall back to just the version
+		version, err = GetJavaVersionAt(javaPath)
+	}
+	if err != nil {
+		return JavaRuntime{}, err
+	}
+	return JavaRuntime{
+		Path:    javaPath,
+		Version: version,
+		Vendor:  properties["java.vendor"],
+		Arch:    javaArch(properties["os.arch"]),
+	}, nil
+}
+
+// javaArch turns Java's os.arch into the names GetArch uses
+func javaArch(osArch string) string {
+	switch osArch {
+	case "amd64", "x86_64":
+		return "x64"
+	case "aarch64", "arm64":
+		return "aarch64"
+	}
+	return osArch
+}
+
+// BestJava picks the runtime to run a server that needs requiredJavaVersion with, or nil if none of them can.
+// One built for this machine wins, then the exact major version, then the closest newer one, then the newest update
+func BestJava(runtimes []JavaRuntime, requiredJavaVersion int) *JavaRuntime {
+	var candidates []JavaRuntime
+	for _, javaRuntime := range runtimes {
+		if javaRuntime.Version.Major >= requiredJavaVersion {
+			candidates = append(candidates, javaRuntime)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	arch := GetArch()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.Arch == arch) != (b.Arch == arch) {
+			return a.Arch == arch
+		}
+		if a.Version.Major != b.Version.Major {
+			return a.Version.Major < b.Version.Major
+		}
+		if a.Version.Minor != b.Version.Minor {
+			return a.Version.Minor > b.Version.Minor
+		}
+		return a.Version.Patch > b.Version.Patch
+	})
+	return &candidates[0]
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// ScriptJava is how a script in the server folder runs javaPath. Relative paths are from the server folder, so they
+// keep working wherever the script is started from. An empty javaPath is the java on the PATH
+func ScriptJava(javaPath string) string {
+	if javaPath == "" {
+		return "java"
+	}
+	if filepath.IsAbs(javaPath) {
+		return fmt.Sprintf("\"%s\"", javaPath)
+	}
+	return fmt.Sprintf("\"$(dirname \"$0\")/%s\"", filepath.ToSlash(javaPath))
+}
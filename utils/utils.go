@@ -2,107 +2,179 @@ package utils
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bufio"
 	"compress/gzip"
-	"crypto/sha256"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/mja00/kami-chan-server-installer/apiclient"
+	"github.com/mja00/kami-chan-server-installer/cache"
+	"github.com/mja00/kami-chan-server-installer/download"
 	"github.com/urfave/cli/v2"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
+// JVMFlags are Aikar's flags, which we start every server with
+const JVMFlags = "-XX:+AlwaysPreTouch -XX:+DisableExplicitGC -XX:+ParallelRefProcEnabled -XX:+PerfDisableSharedMem -XX:+UnlockExperimentalVMOptions -XX:+UseG1GC -XX:G1HeapRegionSize=8M -XX:G1HeapWastePercent=5 -XX:G1MaxNewSizePercent=40 -XX:G1MixedGCCountTarget=4 -XX:G1MixedGCLiveThresholdPercent=90 -XX:G1NewSizePercent=30 -XX:G1RSetUpdatingPauseTimePercent=5 -XX:G1ReservePercent=20 -XX:InitiatingHeapOccupancyPercent=15 -XX:MaxGCPauseMillis=200 -XX:MaxTenuringThreshold=1 -XX:SurvivorRatio=32 -Dusing.aikars.flags=https://mcflags.emc.gs -Daikars.new.flags=true"
+
 type JavaVersion struct {
 	Version string
 	Major   int
 	Minor   int
+	// The security update, the 3 in 21.0.3 or the 402 in 1.8.0_402
+	Patch int
 }
 
 func GetJavaVersion() (JavaVersion, error) {
 	// Just run java -version and parse out the version
-	cmd := exec.Command("java", "-version")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Check to see if the error is a command not found error
-		if strings.Contains(err.Error(), "executable file not found") {
-			return JavaVersion{
-				Version: "unknown",
-				Major:   0,
-				Minor:   0,
-			}, nil
-		}
+	version, err := GetJavaVersionAt("java")
+	// Java not being installed isn't an error, it just means we need to install it
+	if errors.Is(err, exec.ErrNotFound) {
 		return JavaVersion{
 			Version: "unknown",
 			Major:   0,
 			Minor:   0,
-		}, err
-	}
-	// On modern Java (which we care about), the output will follow:
-	// openjdk version "21.0.3" 2024-04-16 LTS
-	// OpenJDK Runtime Environment Temurin-21.0.3+9 (build 21.0.3+9-LTS)
-	// OpenJDK 64-Bit Server VM Temurin-21.0.3+9 (build 21.0.3+9-LTS, mixed mode)
-	// All we care about is the first line, which will be the version
-	// Essentially just grab the string in the quotes
-	version := strings.Split(string(output), "\"")[1]
-	versionSplit := strings.Split(version, ".")
-	major, err := strconv.Atoi(versionSplit[0])
-	if err != nil {
-		return JavaVersion{}, err
-	}
-	minor, err := strconv.Atoi(versionSplit[1])
-	if err != nil {
-		return JavaVersion{}, err
+		}, nil
 	}
-	return JavaVersion{
-		Version: version,
-		Major:   major,
-		Minor:   minor,
-	}, nil
+	return version, err
 }
 
-func MCVersionToJavaMajor(mcVersion string) (int, error) {
-	// 1.8 -> 8+
-	// 1.17 -> 16+
-	// 1.18 -> 17+
-	// 1.20.5 -> 21+
-	// Just return the major version for the given MC version
-	versionSplit := strings.Split(mcVersion, ".")
-	mcMajor, err := strconv.Atoi(versionSplit[1])
-	if err != nil {
-		return 0, err
-	}
-	// 1.8 -> 1.16
-	if mcMajor >= 8 && mcMajor < 17 {
-		return 8, nil
-	} else if mcMajor >= 17 && mcMajor < 18 {
-		return 16, nil
-	} else if mcMajor >= 18 && mcMajor < 20 {
-		return 17, nil
-	} else if mcMajor >= 20 {
-		return 21, nil
-	}
-	return 0, fmt.Errorf("invalid MC version: %s", mcVersion)
+func GetSha256Hash(filePath string) (string, error) {
+	return GetFileHash(filePath, "sha256")
 }
 
-func GetSha256Hash(filePath string) (string, error) {
+// GetFileHash hashes the file with the given algorithm (sha256, sha512, sha1 or md5) and returns it hex encoded
+func GetFileHash(filePath, algorithm string) (string, error) {
+	hash, err := download.NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
 	// Stream the file, that way we don't have to load the whole thing into memory
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
-	hash := sha256.New()
 	if _, err := io.Copy(hash, file); err != nil {
 		return "", err
 	}
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
+// CorrettoURL is where the latest Corretto JDK package for the OS (a GOOS value) and arch (x64 or aarch64) lives
+func CorrettoURL(version int, goos, arch string) (string, error) {
+	switch goos {
+	case "linux":
+		return fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-%s-linux-jdk.deb", version, arch), nil
+	case "darwin":
+		return fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-%s-macos-jdk.pkg", version, arch), nil
+	case "windows":
+		return fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-%s-windows-jdk.msi", version, arch), nil
+	}
+	return "", fmt.Errorf("unsupported OS: %s", goos)
+}
+
+// DownloadCorretto downloads a Corretto package. Corretto publishes the sha256 of its latest packages, which we use to
+// check the download and to find it in the cache if another server already downloaded it. The URL of the exact release
+// that was downloaded is returned, that one doesn't change when Corretto puts out a new release
+func DownloadCorretto(ctx context.Context, javaURL, javaPath string) (string, error) {
+	request, err := CorrettoRequest(ctx, nil, javaURL, javaPath)
+	if err != nil {
+		return "", err
+	}
+	return request.URL, cache.Download(ctx, download.New(), request)
+}
+
+// CorrettoRequest is the download request for a Corretto package, with its sha256 if Corretto gave us it. The request
+// is for the release javaURL points at right now. Both are asked for with client, nil means apiclient.New()
+func CorrettoRequest(ctx context.Context, client *http.Client, javaURL, javaPath string) (download.Request, error) {
+	if client == nil {
+		client = apiclient.New()
+	}
+	releaseURL, err := resolveCorrettoURL(ctx, client, javaURL)
+	if err != nil {
+		return download.Request{}, fmt.Errorf("couldn't find the latest Java release: %s", err)
+	}
+	request := download.Request{
+		URL:         releaseURL,
+		Dest:        javaPath,
+		Description: "Downloading Java",
+	}
+	checksum, err := getCorrettoSha256(ctx, client, javaURL)
+	if err != nil {
+		log.Printf("Couldn't get the checksum for Java, it won't be verified: %s\n", err)
+	} else {
+		request.Algorithm, request.Checksum = "sha256", checksum
+	}
+	return request, nil
+}
+
+// resolveCorrettoURL finds where one of Corretto's latest links redirects to, e.g.
+// https://corretto.aws/downloads/resources/21.0.5.11.1/amazon-corretto-21.0.5.11.1-linux-x64.tar.gz. Anything that
+// doesn't redirect is already the file
+func resolveCorrettoURL(ctx context.Context, client *http.Client, javaURL string) (string, error) {
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	req, err := http.NewRequestWithContext(ctx, "HEAD", javaURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := noRedirects.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return javaURL, nil
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return "", err
+	}
+	return location.String(), nil
+}
+
+// CorrettoChecksumURL is where Corretto publishes the sha256 of the package at javaURL
+func CorrettoChecksumURL(javaURL string) string {
+	// https://corretto.aws/downloads/latest/x.deb has its hash at https://corretto.aws/downloads/latest_sha256/x.deb
+	return strings.Replace(javaURL, "/downloads/latest/", "/downloads/latest_sha256/", 1)
+}
+
+func getCorrettoSha256(ctx context.Context, client *http.Client, javaURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", CorrettoChecksumURL(javaURL), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error getting checksum: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	checksum := strings.TrimSpace(string(body))
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != 64 {
+		return "", fmt.Errorf("invalid checksum: %s", checksum)
+	}
+	return checksum, nil
+}
+
 func GetServerFolder(path string, cCtx *cli.Context) string {
 	serverFolder := cCtx.String("server-dir")
 	if _, err := os.Stat(serverFolder); os.IsNotExist(err) {
@@ -203,56 +275,288 @@ func RunCommandAndPipeAllSTD(cmd *exec.Cmd, noPrefix bool) error {
 	return nil
 }
 
-func ExtractTarGz(gzipStream io.Reader, extractPath string) {
+// ExtractTarGz extracts the tar.gz into extractPath, keeping file modes and symlinks so things like a JDK still work.
+// Anything that would end up outside extractPath is refused
+func ExtractTarGz(gzipStream io.Reader, extractPath string) error {
 	uncompressedStream, err := gzip.NewReader(gzipStream)
 	if err != nil {
-		log.Fatal("ExtractTarGz: NewReader failed")
+		return fmt.Errorf("error reading gzip: %s", err)
 	}
+	defer uncompressedStream.Close()
 
 	tarReader := tar.NewReader(uncompressedStream)
 
 	// Make sure the extract path exists
-	if _, err := os.Stat(extractPath); os.IsNotExist(err) {
-		err := os.MkdirAll(extractPath, 0755)
-		if err != nil {
-			log.Fatalf("ExtractTarGz: MkdirAll() failed: %s", err.Error())
-		}
+	if err := os.MkdirAll(extractPath, 0755); err != nil {
+		return err
+	}
+	// Symlinks from the archive can point anywhere, so where things really end up gets checked against the real path
+	realExtractPath, err := filepath.EvalSymlinks(extractPath)
+	if err != nil {
+		return err
 	}
 
 	for {
 		header, err := tarReader.Next()
-
 		if err == io.EOF {
-			break
+			return nil
 		}
-
 		if err != nil {
-			log.Fatalf("ExtractTarGz: Next() failed: %s", err.Error())
+			return fmt.Errorf("error reading tar: %s", err)
 		}
 
-		target := filepath.Join(extractPath, header.Name)
+		target, err := SafeJoin(extractPath, header.Name)
+		if err != nil {
+			return err
+		}
+		mode := header.FileInfo().Mode().Perm()
 
 		switch header.Typeflag {
 		case tar.TypeDir:
+			if _, err := realPathInside(realExtractPath, target); err != nil {
+				return err
+			}
 			if err := os.MkdirAll(target, 0755); err != nil {
-				log.Fatalf("ExtractTarGz: MkdirAll() failed: %s", err.Error())
+				return err
+			}
+			// We still need to be able to write into it
+			if err := os.Chmod(target, mode|0700); err != nil {
+				return err
 			}
 		case tar.TypeReg:
-			outFile, err := os.Create(target)
+			if _, err := realPathInside(realExtractPath, filepath.Dir(target)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := extractTarFile(tarReader, target, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// The link has to point somewhere inside extractPath too
+			if filepath.IsAbs(header.Linkname) || strings.HasPrefix(header.Linkname, "/") {
+				return fmt.Errorf("refusing to extract %s, it links to an absolute path", header.Name)
+			}
+			// Relative to where the link really is, an earlier symlink could have moved it
+			realDir, err := realPathInside(realExtractPath, filepath.Dir(target))
 			if err != nil {
-				log.Fatalf("ExtractTarGz: Create() failed: %s", err.Error())
+				return err
 			}
-			if _, err := io.Copy(outFile, tarReader); err != nil {
-				log.Fatalf("ExtractTarGz: Copy() failed: %s", err.Error())
+			realDir, err = filepath.Rel(realExtractPath, realDir)
+			if err != nil {
+				return err
 			}
-			outFile.Close()
-
+			if _, err := SafeJoin(extractPath, path.Join(filepath.ToSlash(realDir), header.Linkname)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			_ = os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := SafeJoin(extractPath, header.Linkname)
+			if err != nil {
+				return err
+			}
+			if _, err := realPathInside(realExtractPath, filepath.Dir(source)); err != nil {
+				return err
+			}
+			if _, err := realPathInside(realExtractPath, filepath.Dir(target)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			_ = os.Remove(target)
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			// Just metadata, nothing to extract
 		default:
-			log.Fatalf(
-				"ExtractTarGz: unknown type: %b in %s",
-				header.Typeflag,
-				header.Name)
+			return fmt.Errorf("unsupported file type %c for %s", header.Typeflag, header.Name)
+		}
+	}
+}
+
+// realPathInside resolves any symlinks in dir and makes sure it's really inside realBase, which has to be resolved
+// already. Only the part of dir that exists so far can be resolved, the rest gets created inside that
+func realPathInside(realBase, dir string) (string, error) {
+	existing, rest := dir, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			realDir := filepath.Join(resolved, rest)
+			relative, err := filepath.Rel(realBase, realDir)
+			if err != nil {
+				return "", err
+			}
+			if relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) || filepath.IsAbs(relative) {
+				return "", fmt.Errorf("refusing to use path outside of %s: %s", realBase, dir)
+			}
+			return realDir, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+func extractTarFile(reader io.Reader, target string, mode os.FileMode) error {
+	if mode == 0 {
+		mode = 0644
+	}
+	_ = os.Remove(target)
+	outFile, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(outFile, reader); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
+
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Copy into a temp file next to the destination first, that way we never leave a half written file behind
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// WriteJVMArgsFile writes a user_jvm_args.txt for servers that start from a Forge run script. Our memory settings and
+// flags replace any earlier ones, everything else in the file (comments, arguments the admin added) is kept
+func WriteJVMArgsFile(path string, ramAmount int) error {
+	ours := append([]string{fmt.Sprintf("-Xms%dM", ramAmount), fmt.Sprintf("-Xmx%dM", ramAmount)}, strings.Fields(JVMFlags)...)
+	replaced := map[string]bool{}
+	for _, arg := range ours {
+		replaced[jvmArgKey(arg)] = true
+	}
+	var lines []string
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(existing), "\n"), "\n") {
+		if line == "" && len(lines) == 0 {
+			continue
+		}
+		if !replaced[jvmArgKey(strings.TrimSpace(line))] {
+			lines = append(lines, line)
 		}
+	}
+	// One argument per line, that's how the installer lays the file out
+	lines = append(lines, ours...)
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// jvmArgKey is what a JVM argument sets, so -Xmx2G and -Xmx4G or -XX:+UseG1GC and -XX:-UseG1GC are the same thing
+func jvmArgKey(arg string) string {
+	switch {
+	case strings.HasPrefix(arg, "-Xms"), strings.HasPrefix(arg, "-Xmx"):
+		return arg[:4]
+	case strings.HasPrefix(arg, "-XX:+"), strings.HasPrefix(arg, "-XX:-"):
+		return "-XX:" + arg[5:]
+	case strings.HasPrefix(arg, "-XX:"), strings.HasPrefix(arg, "-D"):
+		key, _, _ := strings.Cut(arg, "=")
+		return key
+	}
+	return arg
+}
 
+// SafeJoin joins a relative path from an archive or modpack onto base, refusing anything that would end up outside it
+func SafeJoin(base, path string) (string, error) {
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") || strings.HasPrefix(path, "\\") {
+		return "", fmt.Errorf("refusing to use absolute path: %s", path)
+	}
+	target := filepath.Join(base, filepath.FromSlash(path))
+	relative, err := filepath.Rel(base, target)
+	if err != nil {
+		return "", err
+	}
+	if relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to use path outside of %s: %s", base, path)
+	}
+	return target, nil
+}
+
+// ExtractZip extracts the zip into extractPath, refusing any entries that would end up outside of it
+func ExtractZip(zipPath, extractPath string) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := os.MkdirAll(extractPath, 0755); err != nil {
+		return err
+	}
+	for _, file := range reader.File {
+		target, err := SafeJoin(extractPath, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := extractZipFile(file, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(file *zip.File, target string) error {
+	in, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Keep the permissions from the zip if it has any, that way scripts stay executable
+	mode := file.Mode().Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
 	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
 }
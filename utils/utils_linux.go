@@ -2,11 +2,8 @@ package utils
 
 import (
 	"fmt"
-	"github.com/schollz/progressbar/v3"
 	"github.com/urfave/cli/v2"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
@@ -30,44 +27,31 @@ func GetArch() string {
 	}
 }
 
-func DownloadJava(version int, cliCtx *cli.Context) (string, error) {
+func DownloadJava(version int, cliCtx *cli.Context) (string, string, error) {
 	if !cliCtx.Bool("install-java-please") {
 		log.Println("\n\nWe won't actually download Java, as we want you to use 'apt-get' to install it.")
 		log.Println("Don't worry! We'll walk you through it!")
-		return "", nil
+		return "", "", nil
 	}
 	arch := GetArch()
-	javaURL := fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-%s-linux-jdk.deb", version, arch)
+	javaURL, err := CorrettoURL(version, runtime.GOOS, arch)
+	if err != nil {
+		return "", "", err
+	}
 
 	if _, err := os.Stat("./temp"); os.IsNotExist(err) {
 		err := os.MkdirAll("./temp", 0755)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 	}
-	out, err := os.Create(fmt.Sprintf("./temp/java-%d-%s.deb", version, arch))
-	if err != nil {
-		return "", err
-	}
-	defer out.Close()
-
-	resp, err := http.Get(javaURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	bar := progressbar.DefaultBytes(
-		resp.ContentLength,
-		"Downloading Java",
-	)
-
-	_, err = io.Copy(io.MultiWriter(out, bar), resp.Body)
+	javaPath := fmt.Sprintf("./temp/java-%d-%s.deb", version, arch)
+	javaURL, err = DownloadCorretto(cliCtx.Context, javaURL, javaPath)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("./temp/java-%d-%s.deb", version, arch), nil
+	return javaPath, javaURL, nil
 }
 
 func InstallJava(javaPath string, cliCtx *cli.Context) error {
@@ -101,11 +85,11 @@ func InstallJava(javaPath string, cliCtx *cli.Context) error {
 	return RunCommandAndPipeOutput(cmd)
 }
 
-func WriteStartScript(path string, ramAmount int, cliCtx *cli.Context) error {
+func WriteStartScript(path, javaPath, jarName string, ramAmount int, cliCtx *cli.Context) error {
 	// Write our start.sh file
 	startScript := fmt.Sprintf(`#!/usr/bin/env sh
 
-java -Xms%dM -Xmx%dM -XX:+AlwaysPreTouch -XX:+DisableExplicitGC -XX:+ParallelRefProcEnabled -XX:+PerfDisableSharedMem -XX:+UnlockExperimentalVMOptions -XX:+UseG1GC -XX:G1HeapRegionSize=8M -XX:G1HeapWastePercent=5 -XX:G1MaxNewSizePercent=40 -XX:G1MixedGCCountTarget=4 -XX:G1MixedGCLiveThresholdPercent=90 -XX:G1NewSizePercent=30 -XX:G1RSetUpdatingPauseTimePercent=5 -XX:G1ReservePercent=20 -XX:InitiatingHeapOccupancyPercent=15 -XX:MaxGCPauseMillis=200 -XX:MaxTenuringThreshold=1 -XX:SurvivorRatio=32 -Dusing.aikars.flags=https://mcflags.emc.gs -Daikars.new.flags=true -jar paper.jar nogui`, ramAmount, ramAmount)
+%s -Xms%dM -Xmx%dM %s -jar %s nogui`, ScriptJava(javaPath), ramAmount, ramAmount, JVMFlags, jarName)
 	err := os.WriteFile(fmt.Sprintf("%s.sh", path), []byte(startScript), 0755)
 	if err != nil {
 		return err
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// tarEntry is one file, folder or link in a test archive
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func makeTarGz(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.linkname, Mode: 0644, Size: int64(len(entry.content))}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.typeflag == tar.TypeReg {
+			if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractTarGz(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	root := t.TempDir()
+	extractPath := filepath.Join(root, "a", "b")
+	archive := makeTarGz(t, []tarEntry{
+		{name: "jdk/bin/java", typeflag: tar.TypeReg, content: "java"},
+		{name: "jdk/bin/current", typeflag: tar.TypeSymlink, linkname: "java"},
+		{name: "jdk/lib", typeflag: tar.TypeDir},
+		{name: "jdk/lib/java", typeflag: tar.TypeLink, linkname: "jdk/bin/java"},
+	})
+	if err := ExtractTarGz(archive, extractPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"jdk/bin/java", "jdk/bin/current", "jdk/lib/java"} {
+		content, err := os.ReadFile(filepath.Join(extractPath, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "java" {
+			t.Errorf("%s has %q in it, expected java", name, content)
+		}
+	}
+}
+
+func TestExtractTarGzRefusesEscapingThroughSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	root := t.TempDir()
+	extractPath := filepath.Join(root, "a", "b")
+	// s points at the extract folder, so s/s/l is really in the extract folder and ../.. from it is root
+	archive := makeTarGz(t, []tarEntry{
+		{name: "s", typeflag: tar.TypeSymlink, linkname: "."},
+		{name: "s/s/l", typeflag: tar.TypeSymlink, linkname: "../.."},
+		{name: "s/s/l/escaped.txt", typeflag: tar.TypeReg, content: "escaped"},
+	})
+	if err := ExtractTarGz(archive, extractPath); err == nil {
+		t.Error("expected the archive to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped.txt")); err == nil {
+		t.Error("escaped.txt was written outside of the extract folder")
+	}
+}
+
+func TestExtractTarGzRefusesWritingThroughSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+	root := t.TempDir()
+	outside := filepath.Join(root, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	extractPath := filepath.Join(root, "extract")
+	if err := os.Mkdir(extractPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(extractPath, "jdk"), []byte("jdk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A link that was already there, say from an earlier extract, is just as bad as one from the archive
+	if err := os.Symlink(outside, filepath.Join(extractPath, "l")); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]tarEntry{
+		"file":     {name: "l/escaped.txt", typeflag: tar.TypeReg, content: "escaped"},
+		"folder":   {name: "l/escaped", typeflag: tar.TypeDir},
+		"hardlink": {name: "l/escaped.txt", typeflag: tar.TypeLink, linkname: "jdk"},
+		"symlink":  {name: "l/escaped.txt", typeflag: tar.TypeSymlink, linkname: "jdk"},
+	}
+	for name, entry := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := ExtractTarGz(makeTarGz(t, []tarEntry{entry}), extractPath); err == nil {
+				t.Error("expected the archive to be refused")
+			}
+			entries, _ := os.ReadDir(outside)
+			if len(entries) != 0 {
+				t.Errorf("%s was written outside of the extract folder", entries[0].Name())
+			}
+		})
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "server")
+	tests := map[string]bool{
+		"world/level.dat":      true,
+		"config/../mods/a.jar": true,
+		"../escaped.txt":       false,
+		"mods/../../escaped":   false,
+		"/etc/passwd":          false,
+		"\\windows\\escaped":   false,
+		"..":                   false,
+	}
+	for path, ok := range tests {
+		target, err := SafeJoin(base, path)
+		if ok && err != nil {
+			t.Errorf("SafeJoin(%q) failed: %s", path, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("SafeJoin(%q) = %s, expected it to be refused", path, target)
+		}
+	}
+}
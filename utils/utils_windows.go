@@ -3,11 +3,8 @@ package utils
 import (
 	"fmt"
 	"github.com/fatih/color"
-	"github.com/schollz/progressbar/v3"
 	"github.com/urfave/cli/v2"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -32,39 +29,26 @@ func GetArch() string {
 	}
 }
 
-func DownloadJava(version int, _ *cli.Context) (string, error) {
+func DownloadJava(version int, cliCtx *cli.Context) (string, string, error) {
 	arch := GetArch()
-	javaURL := fmt.Sprintf("https://corretto.aws/downloads/latest/amazon-corretto-%d-x64-windows-jdk.msi", version)
+	javaURL, err := CorrettoURL(version, runtime.GOOS, arch)
+	if err != nil {
+		return "", "", err
+	}
 
 	if _, err := os.Stat("temp"); os.IsNotExist(err) {
 		err := os.MkdirAll("temp", 0755)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 	}
-	out, err := os.Create(filepath.Join("temp", fmt.Sprintf("java-%d-%s.msi", version, arch)))
+	javaPath := filepath.Join("temp", fmt.Sprintf("java-%d-%s.msi", version, arch))
+	javaURL, err = DownloadCorretto(cliCtx.Context, javaURL, javaPath)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	defer out.Close()
 
-	resp, err := http.Get(javaURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	bar := progressbar.DefaultBytes(
-		resp.ContentLength,
-		"Downloading Java",
-	)
-
-	_, err = io.Copy(io.MultiWriter(out, bar), resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return filepath.Join("temp", fmt.Sprintf("java-%d-%s.msi", version, arch)), nil
+	return javaPath, javaURL, nil
 }
 
 func InstallJava(javaPath string, cliCtx *cli.Context) error {
@@ -80,12 +64,24 @@ func InstallJava(javaPath string, cliCtx *cli.Context) error {
 	return RunCommandAndPipeOutput(cmd)
 }
 
-func WriteStartScript(path string, ramAmount int, cliCtx *cli.Context) error {
+// ScriptJava is how a script in the server folder runs javaPath. Relative paths are from the server folder, so they
+// keep working wherever the script is started from. An empty javaPath is the java on the PATH
+func ScriptJava(javaPath string) string {
+	if javaPath == "" {
+		return "java"
+	}
+	if filepath.IsAbs(javaPath) {
+		return fmt.Sprintf("\"%s\"", javaPath)
+	}
+	return fmt.Sprintf("\"%%~dp0%s\"", filepath.FromSlash(javaPath))
+}
+
+func WriteStartScript(path, javaPath, jarName string, ramAmount int, cliCtx *cli.Context) error {
 	startScript := fmt.Sprintf(`@echo off
 
-java -Xms%sM -Xmx%sM -XX:+AlwaysPreTouch -XX:+DisableExplicitGC -XX:+ParallelRefProcEnabled -XX:+PerfDisableSharedMem -XX:+UnlockExperimentalVMOptions -XX:+UseG1GC -XX:G1HeapRegionSize=8M -XX:G1HeapWastePercent=5 -XX:G1MaxNewSizePercent=40 -XX:G1MixedGCCountTarget=4 -XX:G1MixedGCLiveThresholdPercent=90 -XX:G1NewSizePercent=30 -XX:G1RSetUpdatingPauseTimePercent=5 -XX:G1ReservePercent=20 -XX:InitiatingHeapOccupancyPercent=15 -XX:MaxGCPauseMillis=200 -XX:MaxTenuringThreshold=1 -XX:SurvivorRatio=32 -Dusing.aikars.flags=https://mcflags.emc.gs -Daikars.new.flags=true -jar paper.jar nogui
+%s -Xms%dM -Xmx%dM %s -jar %s nogui
 
-pause`, ramAmount, ramAmount)
+pause`, ScriptJava(javaPath), ramAmount, ramAmount, JVMFlags, jarName)
 	err := os.WriteFile(fmt.Sprintf("%s.bat", path), []byte(startScript), 0755)
 	if err != nil {
 		return err